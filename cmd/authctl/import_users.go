@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/prfc0/authN/internal/password"
+	"github.com/prfc0/authN/internal/store"
+	"github.com/prfc0/authN/internal/store/sqlite"
+	"github.com/prfc0/authN/internal/username"
+)
+
+// importedUser is one record of an import file.
+type importedUser struct {
+	Username     string `json:"username"`
+	PasswordHash string `json:"password_hash"`
+}
+
+// importUsers creates users from a CSV, JSON or htpasswd file whose password
+// hashes come from another system. Hashes are stored as-is and upgraded to
+// the server's hasher on each user's first login. Usernames are only
+// canonicalized and must not clash with an existing name or a look-alike of
+// one, since legacy names often break the registration rules; -strict applies
+// those rules too, including AUTH_RESERVED_USERNAMES.
+func importUsers(args []string) error {
+	fs := flag.NewFlagSet("import-users", flag.ContinueOnError)
+	dbPath := fs.String("db", defaultDBPath(), "path to the SQLite database")
+	format := fs.String("format", "", "csv, json or htpasswd (default: from the file extension)")
+	strict := fs.Bool("strict", false, "reject usernames that registration would refuse")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: authctl import-users [flags] <file|->")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	path := fs.Arg(0)
+	if *format == "" {
+		*format = strings.TrimPrefix(filepath.Ext(path), ".")
+	}
+
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	var users []importedUser
+	var err error
+	switch *format {
+	case "csv":
+		users, err = readUsersCSV(in)
+	case "json":
+		users, err = readUsersJSON(in)
+	case "htpasswd":
+		users, err = readUsersHtpasswd(in)
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	if err != nil {
+		return err
+	}
+
+	db, err := sqlite.Open(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := sqlite.Migrate(db); err != nil {
+		return err
+	}
+	us := sqlite.NewSQLiteUserStore(db)
+	pw := password.NewManager(password.DefaultArgon2id)
+	rules := username.DefaultRules.WithReserved(os.Getenv("AUTH_RESERVED_USERNAMES"))
+
+	ctx := context.Background()
+	var imported, existing, rejected int
+	for i, u := range users {
+		name := username.Canonicalize(u.Username)
+		if *strict {
+			if name, err = rules.Parse(u.Username); err != nil {
+				fmt.Fprintf(os.Stderr, "record %d (%s): %v\n", i+1, u.Username, err)
+				rejected++
+				continue
+			}
+		} else if name.Canonical == "" {
+			fmt.Fprintf(os.Stderr, "record %d: empty username\n", i+1)
+			rejected++
+			continue
+		}
+		if !pw.Recognizes(u.PasswordHash) {
+			fmt.Fprintf(os.Stderr, "record %d (%s): unsupported password hash format\n", i+1, u.Username)
+			rejected++
+			continue
+		}
+		_, err = us.CreateUser(ctx, name, "", u.PasswordHash)
+		if errors.Is(err, store.ErrUserExists) {
+			fmt.Fprintf(os.Stderr, "record %d (%s): skipped, the username or a look-alike already exists\n", i+1, u.Username)
+			existing++
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("record %d (%s): %w", i+1, u.Username, err)
+		}
+		imported++
+	}
+	fmt.Printf("imported %d users, %d already existed, %d rejected\n", imported, existing, rejected)
+	return nil
+}
+
+// readUsersCSV reads a CSV file with a header naming the username and
+// password_hash columns; other columns are ignored.
+func readUsersCSV(r io.Reader) ([]importedUser, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	col := map[string]int{}
+	for i, name := range header {
+		col[strings.TrimSpace(name)] = i
+	}
+	ui, ok1 := col["username"]
+	hi, ok2 := col["password_hash"]
+	if !ok1 || !ok2 {
+		return nil, errors.New("csv header must name username and password_hash columns")
+	}
+
+	var users []importedUser
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return users, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		var u importedUser
+		if ui < len(rec) {
+			u.Username = strings.TrimSpace(rec[ui])
+		}
+		if hi < len(rec) {
+			u.PasswordHash = strings.TrimSpace(rec[hi])
+		}
+		users = append(users, u)
+	}
+}
+
+// readUsersJSON reads a JSON array of {"username", "password_hash"} objects.
+func readUsersJSON(r io.Reader) ([]importedUser, error) {
+	var users []importedUser
+	if err := json.NewDecoder(r).Decode(&users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// readUsersHtpasswd reads "user:hash" lines, skipping blanks and comments.
+func readUsersHtpasswd(r io.Reader) ([]importedUser, error) {
+	var users []importedUser
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, hash, _ := strings.Cut(line, ":")
+		users = append(users, importedUser{Username: name, PasswordHash: hash})
+	}
+	return users, sc.Err()
+}
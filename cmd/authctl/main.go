@@ -0,0 +1,49 @@
+// Command authctl runs maintenance tasks against the authN database.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+const usage = `usage: authctl <command> [flags]
+
+commands:
+  purge-tokens   delete expired refresh tokens past the retention window
+  import-users   create users with password hashes from another system
+`
+
+// commands maps a subcommand name to its implementation, which receives the
+// remaining arguments.
+var commands = map[string]func(args []string) error{
+	"purge-tokens": purgeTokens,
+	"import-users": importUsers,
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "authctl: unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+	if err := cmd(os.Args[2:]); errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "authctl %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+// defaultDBPath mirrors the server: AUTH_DB_PATH, else ./auth.db.
+func defaultDBPath() string {
+	if p := os.Getenv("AUTH_DB_PATH"); p != "" {
+		return p
+	}
+	return "./auth.db"
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/prfc0/authN/internal/store/sqlite"
+)
+
+// purgeTokens runs the refresh token janitor once.
+func purgeTokens(args []string) error {
+	fs := flag.NewFlagSet("purge-tokens", flag.ContinueOnError)
+	dbPath := fs.String("db", defaultDBPath(), "path to the SQLite database")
+	retention := fs.Duration("retention", sqlite.DefaultTokenRetention, "keep rows this long after they expire")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	db, err := sqlite.Open(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := sqlite.Migrate(db); err != nil {
+		return err
+	}
+
+	n, err := sqlite.PurgeRefreshTokens(context.Background(), db, time.Now(), *retention)
+	if err != nil {
+		return err
+	}
+	m, err := sqlite.PurgeOneTimeTokens(context.Background(), db, time.Now(), *retention)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("purged %d refresh tokens, %d one-time tokens\n", n, m)
+	return nil
+}
@@ -1,15 +1,25 @@
 package main
 
 import (
+	"context"
 	"log"
+	"net/url"
 	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
-	"database/sql"
-
+	"github.com/prfc0/authN/internal/mail"
+	"github.com/prfc0/authN/internal/password"
+	"github.com/prfc0/authN/internal/policy"
+	"github.com/prfc0/authN/internal/revocation"
 	"github.com/prfc0/authN/internal/server"
 	"github.com/prfc0/authN/internal/store/sqlite"
 	"github.com/prfc0/authN/internal/token"
-	_ "modernc.org/sqlite"
+	"github.com/prfc0/authN/internal/username"
 )
 
 func main() {
@@ -18,29 +28,330 @@ func main() {
 		dbPath = "./auth.db"
 	}
 
-	db, err := sql.Open("sqlite", "file:"+dbPath+"?_foreign_keys=1&_busy_timeout=5000")
+	db, err := sqlite.Open(dbPath)
 	if err != nil {
 		log.Fatalf("open db: %v", err)
 	}
 	defer db.Close()
 
-	if err := sqlite.EnsureUsersTable(db); err != nil {
-		log.Fatalf("users migrations failed: %v", err)
-	}
-	if err := sqlite.EnsureRefreshTokensTable(db); err != nil {
-		log.Fatalf("refresh_tokens migration failed: %v", err)
+	if err := sqlite.Migrate(db); err != nil {
+		log.Fatalf("migrations failed: %v", err)
 	}
 
 	store := sqlite.NewSQLiteUserStore(db)
-	jwtSecret := os.Getenv("AUTH_JWT_SECRET")
-	if jwtSecret == "" {
-		jwtSecret = "super_secret_change_me"
-		// log.Fatal("AUTH_JWT_SECRET not set")
+	revocations := sqlite.NewSQLiteRevocationStore(db)
+	revocation.StartPruner(context.Background(), revocations, time.Minute)
+	// AUTH_TOKEN_RETENTION: how long expired refresh tokens are kept;
+	// AUTH_JANITOR_INTERVAL: how often they are purged
+	retention, janitorInterval := sqlite.DefaultTokenRetention, time.Hour
+	if v := os.Getenv("AUTH_TOKEN_RETENTION"); v != "" {
+		if retention, err = time.ParseDuration(v); err != nil {
+			log.Fatalf("AUTH_TOKEN_RETENTION: %v", err)
+		}
+	}
+	if v := os.Getenv("AUTH_JANITOR_INTERVAL"); v != "" {
+		if janitorInterval, err = time.ParseDuration(v); err != nil || janitorInterval <= 0 {
+			log.Fatalf("AUTH_JANITOR_INTERVAL: invalid duration %q", v)
+		}
+	}
+	sqlite.StartRefreshTokenJanitor(context.Background(), db, janitorInterval, retention)
+	// AUTH_ACCOUNT_RESTORE_WINDOW: how long deleted accounts can be restored
+	// before they are purged; unset deletes them at once
+	var restoreWindow time.Duration
+	if v := os.Getenv("AUTH_ACCOUNT_RESTORE_WINDOW"); v != "" {
+		if restoreWindow, err = time.ParseDuration(v); err != nil || restoreWindow < 0 {
+			log.Fatalf("AUTH_ACCOUNT_RESTORE_WINDOW: invalid duration %q", v)
+		}
+	}
+	if restoreWindow > 0 {
+		sqlite.StartDeletedUserJanitor(context.Background(), db, janitorInterval, restoreWindow)
+	}
+	issuer := os.Getenv("AUTH_ISSUER")
+	if issuer == "" {
+		issuer = "http://localhost:8080"
+	}
+	// AUTH_AUDIENCES="backend,billing"; the first is the default audience
+	audiences := splitList(os.Getenv("AUTH_AUDIENCES"))
+	backendAudience := ""
+	if len(audiences) > 0 {
+		backendAudience = audiences[0]
+	}
+	// AUTH_SELF_AUDIENCE is what this service's own account and session routes
+	// require (default: the issuer, once audiences are in use); tokens can be
+	// requested for it like for any configured audience
+	selfAudience := os.Getenv("AUTH_SELF_AUDIENCE")
+	if selfAudience == "" && len(audiences) > 0 {
+		selfAudience = issuer
+	}
+	if selfAudience != "" && !slices.Contains(audiences, selfAudience) {
+		audiences = append(audiences, selfAudience)
+	}
+	leeway := token.DefaultLeeway
+	if v := os.Getenv("AUTH_CLOCK_SKEW"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			log.Fatalf("AUTH_CLOCK_SKEW: invalid duration %q", v)
+		}
+		leeway = d
+	}
+	tokenOpts := []token.Option{
+		token.WithRevocationStore(revocations),
+		token.WithIssuer(issuer),
+		token.WithAudiences(audiences...),
+		token.WithLeeway(leeway),
+	}
+
+	// lifetimes: AUTH_ACCESS_TOKEN_TTL, AUTH_REFRESH_TOKEN_TTL and
+	// AUTH_REMEMBER_ME_REFRESH_TTL set the defaults; AUTH_CLIENT_TOKEN_TTLS and
+	// AUTH_ROLE_TOKEN_TTLS="admin=5m/0" override them (access / refresh, 0 inherits)
+	pol := policy.Default()
+	durations := map[string]*time.Duration{
+		"AUTH_ACCESS_TOKEN_TTL":        &pol.Tokens.Default.AccessTTL,
+		"AUTH_REFRESH_TOKEN_TTL":       &pol.Tokens.Default.RefreshTTL,
+		"AUTH_REMEMBER_ME_REFRESH_TTL": &pol.Tokens.RememberMeRefreshTTL,
+		"AUTH_SESSION_MAX_AGE":         &pol.Sessions.Default.MaxAge,
+		"AUTH_SESSION_IDLE_TIMEOUT":    &pol.Sessions.Default.IdleTimeout,
+	}
+	for name, dst := range durations {
+		if v := os.Getenv(name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				log.Fatalf("%s: %v", name, err)
+			}
+			*dst = d
+		}
+	}
+	if pol.Tokens.Default.AccessTTL <= 0 || pol.Tokens.Default.RefreshTTL <= 0 {
+		log.Fatal("AUTH_ACCESS_TOKEN_TTL and AUTH_REFRESH_TOKEN_TTL must be positive")
+	}
+	if pol.Tokens.ByClient, err = policy.ParseLifetimes(os.Getenv("AUTH_CLIENT_TOKEN_TTLS")); err != nil {
+		log.Fatalf("AUTH_CLIENT_TOKEN_TTLS: %v", err)
+	}
+	if pol.Tokens.ByRole, err = policy.ParseLifetimes(os.Getenv("AUTH_ROLE_TOKEN_TTLS")); err != nil {
+		log.Fatalf("AUTH_ROLE_TOKEN_TTLS: %v", err)
+	}
+	// AUTH_SESSION_POLICIES="mobile=2160h/720h,cli=12h/1h" (max age / idle timeout)
+	if pol.Sessions, err = policy.ParseSessions(os.Getenv("AUTH_SESSION_POLICIES"), pol.Sessions.Default); err != nil {
+		log.Fatalf("AUTH_SESSION_POLICIES: %v", err)
+	}
+	// AUTH_EMAIL_VERIFICATION_URL points links at a frontend page instead of the API
+	verificationTTL := 24 * time.Hour
+	if v := os.Getenv("AUTH_EMAIL_VERIFICATION_TTL"); v != "" {
+		if verificationTTL, err = time.ParseDuration(v); err != nil || verificationTTL <= 0 {
+			log.Fatalf("AUTH_EMAIL_VERIFICATION_TTL: invalid duration %q", v)
+		}
+	}
+	// a rotated-out key must outlive the access tokens and verification links
+	// it signed, so AUTH_JWT_KEY_RETIRE_AFTER can only lengthen that
+	retireAfter := token.RetireAfterFor(token.DefaultRetireAfter, max(pol.Tokens.MaxAccessTTL(), verificationTTL), leeway)
+	if v := os.Getenv("AUTH_JWT_KEY_RETIRE_AFTER"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("AUTH_JWT_KEY_RETIRE_AFTER: %v", err)
+		}
+		if d < retireAfter {
+			log.Printf("AUTH_JWT_KEY_RETIRE_AFTER: raised from %s to %s to outlive issued tokens", d, retireAfter)
+		} else {
+			retireAfter = d
+		}
+	}
+
+	// the signing key comes from AUTH_JWT_PRIVATE_KEY_FILE, AUTH_JWT_SECRET_FILE
+	// or AUTH_JWT_SECRET; the files are re-read on SIGHUP
+	var loadKey func() (*token.SigningKey, error)
+	var previous []*token.SigningKey
+	keyFile := os.Getenv("AUTH_JWT_PRIVATE_KEY_FILE")
+	secretFile := os.Getenv("AUTH_JWT_SECRET_FILE")
+	switch {
+	case keyFile != "":
+		loadKey = func() (*token.SigningKey, error) { return token.LoadPrivateKeyFile(keyFile) }
+		// previous keys keep verifying tokens issued before a restart-based rotation
+		for _, f := range splitList(os.Getenv("AUTH_JWT_PREVIOUS_KEY_FILES")) {
+			prev, err := token.LoadPrivateKeyFile(f)
+			if err != nil {
+				log.Fatalf("load previous signing key %s: %v", f, err)
+			}
+			previous = append(previous, prev)
+		}
+	case secretFile != "":
+		loadKey = func() (*token.SigningKey, error) { return token.LoadHMACKeyFile(secretFile) }
+	default:
+		jwtSecret := os.Getenv("AUTH_JWT_SECRET")
+		if jwtSecret == "" {
+			jwtSecret = "super_secret_change_me"
+			// log.Fatal("AUTH_JWT_SECRET not set")
+		}
+		loadKey = func() (*token.SigningKey, error) { return token.NewHMACKey([]byte(jwtSecret)), nil }
+	}
+	if keyFile == "" {
+		// AUTH_JWT_PREVIOUS_SECRETS="old1,old2" keep verifying after a secret change
+		for _, secret := range splitList(os.Getenv("AUTH_JWT_PREVIOUS_SECRETS")) {
+			previous = append(previous, token.NewHMACKey([]byte(secret)))
+		}
+	}
+	key, err := loadKey()
+	if err != nil {
+		log.Fatalf("load signing key: %v", err)
+	}
+	ring := token.NewKeyRing(key, retireAfter)
+	for _, prev := range previous {
+		ring.AddVerificationKey(prev)
+	}
+	tm := token.NewManagerWithKeyRing(ring, db, tokenOpts...)
+	log.Printf("signing access tokens with %s (kid %s)", tm.Algorithm(), tm.KeyRing().Active().ID())
+
+	// SIGHUP re-reads the key or secret file and rotates to it without a restart.
+	if keyFile != "" || secretFile != "" {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				key, err := loadKey()
+				if err != nil {
+					log.Printf("rotate signing key: %v", err)
+					continue
+				}
+				tm.RotateSigningKey(key)
+				log.Printf("signing key rotated to kid %s", key.ID())
+			}
+		}()
+	}
+	// AUTH_INTROSPECTION_CLIENTS="gateway:secret,other:secret2"
+	introspectionClients := map[string]string{}
+	for _, entry := range splitList(os.Getenv("AUTH_INTROSPECTION_CLIENTS")) {
+		id, secret, ok := strings.Cut(entry, ":")
+		if !ok || id == "" || secret == "" {
+			log.Fatalf("AUTH_INTROSPECTION_CLIENTS: malformed entry %q", entry)
+		}
+		introspectionClients[id] = secret
+	}
+	refreshGrace := 10 * time.Second
+	if v := os.Getenv("AUTH_REFRESH_GRACE_PERIOD"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			log.Fatalf("AUTH_REFRESH_GRACE_PERIOD: invalid duration %q", v)
+		}
+		refreshGrace = d
+	}
+	// AUTH_PASSWORD_HASHER="argon2id:m=65536,t=3,p=4" | "bcrypt:cost=12" | "scrypt:ln=15,r=8,p=1";
+	// existing hashes in another format or with other parameters are upgraded on login
+	hasher := password.Hasher(password.DefaultArgon2id)
+	if v := os.Getenv("AUTH_PASSWORD_HASHER"); v != "" {
+		if hasher, err = password.ParseHasher(v); err != nil {
+			log.Fatalf("AUTH_PASSWORD_HASHER: %v", err)
+		}
+	}
+	// AUTH_PASSWORD_HASH_CONCURRENCY caps simultaneous argon2id/scrypt hashes,
+	// and with it their memory (default GOMAXPROCS)
+	if v := os.Getenv("AUTH_PASSWORD_HASH_CONCURRENCY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			log.Fatalf("AUTH_PASSWORD_HASH_CONCURRENCY: invalid number %q", v)
+		}
+		password.SetMaxConcurrentHashes(n)
 	}
-	tm := token.NewManager(jwtSecret, db)
-	srv := server.New(store, tm)
+	// AUTH_PASSWORD_POLICY="min=12,max=128,classes=0,score=2,username=1,normalize=1";
+	// AUTH_PASSWORD_COMMON_LIST replaces the built-in common password list (one per line)
+	passwordPolicy := password.DefaultPolicy
+	if v := os.Getenv("AUTH_PASSWORD_POLICY"); v != "" {
+		if passwordPolicy, err = password.ParsePolicy(v); err != nil {
+			log.Fatalf("AUTH_PASSWORD_POLICY: %v", err)
+		}
+	}
+	if v := os.Getenv("AUTH_PASSWORD_COMMON_LIST"); v != "" {
+		f, err := os.Open(v)
+		if err != nil {
+			log.Fatalf("AUTH_PASSWORD_COMMON_LIST: %v", err)
+		}
+		passwordPolicy.Common, err = password.LoadDictionary(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("AUTH_PASSWORD_COMMON_LIST: %v", err)
+		}
+	}
+	passwordOpts := []password.Option{password.WithPolicy(passwordPolicy)}
+	// AUTH_BREACHED_PASSWORDS_FILE: sorted "SHA1:COUNT" file or per-prefix directory;
+	// AUTH_BREACHED_PASSWORDS_URL: Pwned Passwords range API, e.g. https://api.pwnedpasswords.com
+	if v := os.Getenv("AUTH_BREACHED_PASSWORDS_FILE"); v != "" {
+		corpus, err := password.OpenBreachCorpus(v)
+		if err != nil {
+			log.Fatalf("AUTH_BREACHED_PASSWORDS_FILE: %v", err)
+		}
+		defer corpus.Close()
+		passwordOpts = append(passwordOpts, password.WithBreachChecker(corpus))
+	} else if v := os.Getenv("AUTH_BREACHED_PASSWORDS_URL"); v != "" {
+		passwordOpts = append(passwordOpts, password.WithBreachChecker(password.NewRangeClient(v)))
+	}
+	// AUTH_RESERVED_USERNAMES="acme,billing" adds to the built-in reserved names
+	usernameRules := username.DefaultRules.WithReserved(os.Getenv("AUTH_RESERVED_USERNAMES"))
+	// mail: AUTH_SMTP_ADDR="smtp.example.com:587" with AUTH_MAIL_FROM (and
+	// AUTH_SMTP_USERNAME / AUTH_SMTP_PASSWORD) sends real email; for local
+	// development AUTH_MAIL_DIR writes .eml files, otherwise emails are logged
+	var mailer mail.Mailer = mail.LogMailer{}
+	mailFrom := os.Getenv("AUTH_MAIL_FROM")
+	if v := os.Getenv("AUTH_SMTP_ADDR"); v != "" {
+		if mailFrom == "" {
+			log.Fatal("AUTH_SMTP_ADDR requires AUTH_MAIL_FROM")
+		}
+		mailer = &mail.SMTPMailer{
+			Addr:     v,
+			From:     mailFrom,
+			Username: os.Getenv("AUTH_SMTP_USERNAME"),
+			Password: os.Getenv("AUTH_SMTP_PASSWORD"),
+		}
+	} else if v := os.Getenv("AUTH_MAIL_DIR"); v != "" {
+		if err := os.MkdirAll(v, 0o700); err != nil {
+			log.Fatalf("AUTH_MAIL_DIR: %v", err)
+		}
+		mailer = &mail.FileMailer{Dir: v, From: mailFrom}
+	}
+	// AUTH_PASSWORD_RESET_URL: frontend page for choosing the new password,
+	// which enables password reset; AUTH_PASSWORD_RESET_TTL: how long reset
+	// links stay valid
+	resetURL := os.Getenv("AUTH_PASSWORD_RESET_URL")
+	if resetURL == "" {
+		log.Println("password reset disabled: AUTH_PASSWORD_RESET_URL is not set")
+	} else if u, err := url.Parse(resetURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		log.Fatalf("AUTH_PASSWORD_RESET_URL: invalid URL %q", resetURL)
+	}
+	var resetTTL time.Duration
+	if v := os.Getenv("AUTH_PASSWORD_RESET_TTL"); v != "" {
+		if resetTTL, err = time.ParseDuration(v); err != nil || resetTTL <= 0 {
+			log.Fatalf("AUTH_PASSWORD_RESET_TTL: invalid duration %q", v)
+		}
+	}
+
+	srv := server.New(store, tm, server.Config{
+		Issuer:               issuer,
+		IntrospectionClients: introspectionClients,
+		BackendAudience:      backendAudience,
+		SelfAudience:         selfAudience,
+		RefreshGracePeriod:   refreshGrace,
+		Policy:               pol,
+		DebugVars:            os.Getenv("AUTH_DEBUG_VARS") == "1",
+		Passwords:            password.NewManager(hasher, passwordOpts...),
+		Usernames:            &usernameRules,
+		Mailer:               mailer,
+		EmailVerificationURL: os.Getenv("AUTH_EMAIL_VERIFICATION_URL"),
+		EmailVerificationTTL: verificationTTL,
+		RequireVerifiedEmail: os.Getenv("AUTH_REQUIRE_VERIFIED_EMAIL") == "1",
+		PasswordResetURL:     resetURL,
+		PasswordResetTTL:     resetTTL,
+		AccountRestoreWindow: restoreWindow,
+	})
 	log.Println("listening on :8080")
 	if err := srv.ListenAndServe(":8080"); err != nil {
 		log.Fatalf("server: %v", err)
 	}
 }
+
+// splitList splits a comma-separated env value, dropping empty entries.
+func splitList(v string) []string {
+	var out []string
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
@@ -5,6 +5,7 @@ require modernc.org/sqlite v1.15.0 // version as needed
 require (
 	github.com/golang-jwt/jwt/v5 v5.3.0
 	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
+	golang.org/x/text v0.3.3
 )
 
 require (
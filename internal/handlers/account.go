@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/prfc0/authN/internal/middleware"
+	"github.com/prfc0/authN/internal/model"
+	"github.com/prfc0/authN/internal/notify"
+	"github.com/prfc0/authN/internal/password"
+	"github.com/prfc0/authN/internal/policy"
+	"github.com/prfc0/authN/internal/store"
+	"github.com/prfc0/authN/internal/token"
+	"github.com/prfc0/authN/internal/username"
+)
+
+// ChangePasswordRequest is the body of the change-password endpoint.
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+	// LogoutOtherSessions ends every session except the one making the request.
+	LogoutOtherSessions bool `json:"logout_other_sessions"`
+}
+
+// DeleteAccountRequest re-authenticates the user before deletion.
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+// DeleteAccountResponse reports until when a soft-deleted account can be restored.
+type DeleteAccountResponse struct {
+	Status          string     `json:"status"`
+	RestorableUntil *time.Time `json:"restorable_until,omitempty"`
+}
+
+// RestoreAccountRequest names the deleted account by its credentials, since
+// its sessions ended with the deletion.
+type RestoreAccountRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// MakeChangePasswordHandler changes the authenticated user's password after
+// checking the current one. With logout_other_sessions, every other session
+// ends at once: its refresh tokens and, by sid as in MakeRevokeSessionHandler,
+// its access tokens are revoked. It must sit behind middleware.RequireAuth.
+func MakeChangePasswordHandler(us store.UserStore, tm *token.TokenManager, pw *password.Manager, pol policy.Policy, n notify.Notifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(ErrorResp{Error: "method_not_allowed"})
+			return
+		}
+
+		claims, ok := middleware.ClaimsFromContext(r.Context())
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(ErrorResp{Error: "invalid_token"})
+			return
+		}
+		var req ChangePasswordRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResp{Error: "invalid_json"})
+			return
+		}
+		if req.CurrentPassword == "" || req.NewPassword == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResp{Error: "current_and_new_password_required"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		defer cancel()
+
+		user, ok := authenticatedUser(ctx, w, us, pw, claims.UserID, req.CurrentPassword)
+		if !ok {
+			return
+		}
+		if req.NewPassword == req.CurrentPassword {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResp{Error: "password_unchanged"})
+			return
+		}
+		violations, err := pw.Validate(ctx, req.NewPassword, username.Canonicalize(user.Username).Canonical)
+		if err != nil {
+			log.Printf("change password: breached password check: %v", err)
+		}
+		if len(violations) > 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResp{Error: "password_policy_violation", Details: violations})
+			return
+		}
+		hash, err := pw.Hash(req.NewPassword)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(ErrorResp{Error: "internal_error"})
+			return
+		}
+		if err := us.UpdatePasswordHash(ctx, user.ID, hash); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(ErrorResp{Error: "internal_error"})
+			return
+		}
+		if req.LogoutOtherSessions {
+			if err := endOtherSessions(ctx, us, tm, pol, user.ID, claims.SessionID); err != nil {
+				log.Printf("change password of user %d: %v", user.ID, err)
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(ErrorResp{Error: "internal_error"})
+				return
+			}
+		}
+		notifyPasswordChanged(n, user)
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"status": "password_changed"})
+	}
+}
+
+// endOtherSessions revokes the refresh and access tokens of every session of
+// userID except keep.
+func endOtherSessions(ctx context.Context, us store.UserStore, tm *token.TokenManager, pol policy.Policy, userID int64, keep string) error {
+	sids, err := us.RevokeOtherSessions(ctx, userID, keep)
+	if err != nil {
+		return err
+	}
+	until := time.Now().Add(pol.Tokens.MaxAccessTTL())
+	for _, sid := range sids {
+		if err := tm.RevokeAccessTokensForSession(ctx, sid, until); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MakeDeleteAccountHandler deletes the authenticated user after checking
+// their password. With a positive restoreWindow the account is only marked
+// deleted, its sessions ended, and it can be restored until the window passes;
+// otherwise it is removed at once with its tokens. Either way every access
+// token of the user stops working. It must sit behind middleware.RequireAuth.
+func MakeDeleteAccountHandler(us store.UserStore, tm *token.TokenManager, pw *password.Manager, restoreWindow time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(ErrorResp{Error: "method_not_allowed"})
+			return
+		}
+
+		claims, ok := middleware.ClaimsFromContext(r.Context())
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(ErrorResp{Error: "invalid_token"})
+			return
+		}
+		var req DeleteAccountRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResp{Error: "invalid_json"})
+			return
+		}
+		if req.Password == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResp{Error: "password_required"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		defer cancel()
+
+		user, ok := authenticatedUser(ctx, w, us, pw, claims.UserID, req.Password)
+		if !ok {
+			return
+		}
+
+		resp := DeleteAccountResponse{Status: "deleted"}
+		if restoreWindow > 0 {
+			now := time.Now().UTC()
+			until := now.Add(restoreWindow)
+			resp.RestorableUntil = &until
+			err := us.SoftDeleteUser(ctx, user.ID, now)
+			if err == nil {
+				err = us.RevokeAllRefreshTokensForUser(ctx, user.ID)
+			}
+			if err == nil {
+				err = tm.RevokeAccessTokensForUser(ctx, user.ID)
+			}
+			if err == nil {
+				// the cutoff spares tokens issued within its second
+				err = tm.RevokeAccessToken(ctx, claims)
+			}
+			if err != nil {
+				log.Printf("delete account of user %d: %v", user.ID, err)
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(ErrorResp{Error: "internal_error"})
+				return
+			}
+		} else {
+			// the cutoff outlives the user row; it spares tokens issued
+			// within its second, so the one used here is denylisted too
+			err := tm.RevokeAccessTokensForUser(ctx, user.ID)
+			if err == nil {
+				err = tm.RevokeAccessToken(ctx, claims)
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(ErrorResp{Error: "internal_error"})
+				return
+			}
+			if err := us.DeleteUser(ctx, user.ID); err != nil {
+				log.Printf("delete account of user %d: %v", user.ID, err)
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(ErrorResp{Error: "internal_error"})
+				return
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// MakeRestoreAccountHandler undoes a soft deletion within restoreWindow. The
+// user then logs in as usual.
+func MakeRestoreAccountHandler(us store.UserStore, pw *password.Manager, restoreWindow time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(ErrorResp{Error: "method_not_allowed"})
+			return
+		}
+
+		var req RestoreAccountRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResp{Error: "invalid_json"})
+			return
+		}
+		name := username.Canonicalize(req.Username)
+		if name.Canonical == "" || req.Password == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResp{Error: "username_and_password_required"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		defer cancel()
+
+		user, err := us.GetUserByUsername(ctx, name)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(ErrorResp{Error: "internal_error"})
+			return
+		}
+		if user == nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(ErrorResp{Error: "invalid_credentials"})
+			return
+		}
+		if ok, _, err := pw.Verify(req.Password, user.Password); err != nil || !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(ErrorResp{Error: "invalid_credentials"})
+			return
+		}
+		if user.DeletedAt == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResp{Error: "account_not_deleted"})
+			return
+		}
+
+		restored, err := us.RestoreUser(ctx, user.ID, time.Now().Add(-restoreWindow))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(ErrorResp{Error: "internal_error"})
+			return
+		}
+		if !restored {
+			w.WriteHeader(http.StatusGone)
+			json.NewEncoder(w).Encode(ErrorResp{Error: "restore_window_expired"})
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"status": "restored"})
+	}
+}
+
+// authenticatedUser loads the user behind an access token and checks their
+// password, writing the error response and returning false on failure.
+func authenticatedUser(ctx context.Context, w http.ResponseWriter, us store.UserStore, pw *password.Manager, userID int64, pass string) (*model.User, bool) {
+	user, err := us.GetUserByID(ctx, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ErrorResp{Error: "internal_error"})
+		return nil, false
+	}
+	if user == nil || user.Disabled || user.DeletedAt != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResp{Error: "invalid_token"})
+		return nil, false
+	}
+	ok, _, err := pw.Verify(pass, user.Password)
+	if err != nil {
+		log.Printf("verify password of user %d: %v", user.ID, err)
+	}
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResp{Error: "invalid_credentials"})
+		return nil, false
+	}
+	return user, true
+}
@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/prfc0/authN/internal/mail"
+	"github.com/prfc0/authN/internal/middleware"
+	"github.com/prfc0/authN/internal/model"
+	"github.com/prfc0/authN/internal/password"
+	"github.com/prfc0/authN/internal/store"
+	"github.com/prfc0/authN/internal/token"
+)
+
+// EmailVerification configures how email addresses are verified.
+type EmailVerification struct {
+	Mailer mail.Mailer
+	// LinkURL is where verification links point; the token is added as the
+	// "token" query parameter.
+	LinkURL string
+	TTL     time.Duration
+	// Required makes an email mandatory at registration and refuses login
+	// until it is verified.
+	Required bool
+}
+
+// resendLimit caps how many accounts waiting on one address get a new link
+// per resend request. Unverified addresses are not unique, so anyone can
+// register more accounts with an address; the newest are sent links.
+const resendLimit = 3
+
+// sendTimeout bounds delivery of a single email, which runs in the background.
+const sendTimeout = 30 * time.Second
+
+// sendLink issues a single-use verification token for email and mails the
+// link. Only issuing can fail; delivery errors are logged.
+func (ev EmailVerification) sendLink(ctx context.Context, us store.UserStore, tm *token.TokenManager, user *model.User, email string) error {
+	raw, claims, err := tm.GenerateActionToken(token.PurposeEmailVerification, user.ID, email, ev.TTL)
+	if err != nil {
+		return err
+	}
+	err = us.CreateOneTimeToken(ctx, &model.OneTimeToken{
+		ID:        claims.ID,
+		UserID:    user.ID,
+		Purpose:   token.PurposeEmailVerification,
+		Email:     email,
+		ExpiresAt: claims.ExpiresAt.Time,
+	})
+	if err != nil {
+		return err
+	}
+
+	link, err := url.Parse(ev.LinkURL)
+	if err != nil {
+		return err
+	}
+	q := link.Query()
+	q.Set("token", raw)
+	link.RawQuery = q.Encode()
+	ev.send(mail.Message{
+		To:      email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nopen this link to verify your email address:\n\n%s\n\n"+
+			"The link expires in %s. If you did not ask for this, ignore this email.\n",
+			user.Username, link, ev.TTL),
+	})
+	return nil
+}
+
+// send delivers msg in the background.
+func (ev EmailVerification) send(msg mail.Message) {
+	inBackground("mail to "+msg.To, func(ctx context.Context) error {
+		return ev.Mailer.Send(ctx, msg)
+	})
+}
+
+// inBackground runs a delivery so slow mail servers and other channels don't
+// hold up the response; failures are logged under what.
+func inBackground(what string, deliver func(ctx context.Context) error) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		defer cancel()
+		if err := deliver(ctx); err != nil {
+			log.Printf("%s: %v", what, err)
+		}
+	}()
+}
+
+// EmailRequest is the body of the resend and change-email endpoints.
+type EmailRequest struct {
+	Email string `json:"email"`
+	// Password re-authenticates the user when changing the address.
+	Password string `json:"password,omitempty"`
+}
+
+// MakeVerifyEmailHandler confirms an address from a verification link,
+// accepting the token as a GET query parameter (the link itself) or in a
+// POST body. Each token works once.
+func MakeVerifyEmailHandler(us store.UserStore, tm *token.TokenManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var raw string
+		switch r.Method {
+		case http.MethodGet:
+			raw = r.URL.Query().Get("token")
+		case http.MethodPost:
+			req, err := readTokenRequest(r)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid_request"})
+				return
+			}
+			raw = req.Token
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(map[string]string{"error": "method_not_allowed"})
+			return
+		}
+		if raw == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "token_required"})
+			return
+		}
+
+		claims, err := tm.VerifyActionToken(raw, token.PurposeEmailVerification)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_token"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		defer cancel()
+
+		ott, err := us.ConsumeOneTimeToken(ctx, claims.ID, token.PurposeEmailVerification)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "internal_error"})
+			return
+		}
+		if ott == nil || ott.UserID != claims.UserID || ott.Email != claims.Email {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_token"})
+			return
+		}
+
+		// the address may have changed since the link was sent
+		ok, err := us.ConfirmEmail(ctx, claims.UserID, claims.Email)
+		if errors.Is(err, store.ErrEmailTaken) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]string{"error": "email_taken"})
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "internal_error"})
+			return
+		}
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_token"})
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"status": "verified", "email": claims.Email})
+	}
+}
+
+// MakeResendVerificationHandler mails a new verification link to an
+// unverified address, one for each account waiting on it. The response is the
+// same whether or not the address is known, so it cannot be used to discover
+// accounts.
+func MakeResendVerificationHandler(us store.UserStore, tm *token.TokenManager, ev EmailVerification) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(map[string]string{"error": "method_not_allowed"})
+			return
+		}
+
+		var req EmailRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_json"})
+			return
+		}
+		email, err := mail.NormalizeAddress(req.Email)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_email"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		defer cancel()
+
+		users, err := us.ListUsersByPendingEmail(ctx, email, resendLimit)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "internal_error"})
+			return
+		}
+		for _, user := range users {
+			if user.Disabled || user.DeletedAt != nil {
+				continue
+			}
+			if err := ev.sendLink(ctx, us, tm, user, email); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(map[string]string{"error": "internal_error"})
+				return
+			}
+		}
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"status": "sent"})
+	}
+}
+
+// MakeChangeEmailHandler starts a change of the authenticated user's address.
+// The new address only replaces the current one once its verification link
+// is used, and whether another account uses it is only checked then, so the
+// endpoint reveals nothing about other accounts. A verified current address
+// is told about the request. It must sit
+// behind middleware.RequireAuth.
+func MakeChangeEmailHandler(us store.UserStore, tm *token.TokenManager, pw *password.Manager, ev EmailVerification) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(map[string]string{"error": "method_not_allowed"})
+			return
+		}
+
+		claims, ok := middleware.ClaimsFromContext(r.Context())
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_token"})
+			return
+		}
+		var req EmailRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_json"})
+			return
+		}
+		email, err := mail.NormalizeAddress(req.Email)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_email"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		defer cancel()
+
+		user, err := us.GetUserByID(ctx, claims.UserID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "internal_error"})
+			return
+		}
+		if user == nil || user.Disabled || user.DeletedAt != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_token"})
+			return
+		}
+		if ok, _, err := pw.Verify(req.Password, user.Password); err != nil || !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_credentials"})
+			return
+		}
+		if email == user.Email && user.EmailVerified {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "email_unchanged"})
+			return
+		}
+
+		if email != user.Email {
+			if err := us.SetPendingEmail(ctx, user.ID, email); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(map[string]string{"error": "internal_error"})
+				return
+			}
+		}
+		if err := ev.sendLink(ctx, us, tm, user, email); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "internal_error"})
+			return
+		}
+		if user.EmailVerified && email != user.Email {
+			ev.send(mail.Message{
+				To:      user.Email,
+				Subject: "Your email address is being changed",
+				Body: fmt.Sprintf("Hi %s,\n\nsomeone asked to change the email address of your account to %s. "+
+					"If this wasn't you, change your password now.\n", user.Username, email),
+			})
+		}
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"status": "verification_sent"})
+	}
+}
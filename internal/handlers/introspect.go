@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prfc0/authN/internal/policy"
+	"github.com/prfc0/authN/internal/store"
+	"github.com/prfc0/authN/internal/token"
+)
+
+// TokenRequest is the body shared by introspection and revocation (RFC 7662 / RFC 7009).
+// Both application/x-www-form-urlencoded and JSON bodies are accepted.
+type TokenRequest struct {
+	Token         string `json:"token"`
+	TokenTypeHint string `json:"token_type_hint"`
+	// RevokeChain (revocation only) also revokes every token the refresh token
+	// was rotated into.
+	RevokeChain bool `json:"revoke_chain"`
+}
+
+// IntrospectionResponse follows RFC 7662. Only Active is set for inactive tokens.
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Sub       string `json:"sub,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Iss       string `json:"iss,omitempty"`
+	Aud       string `json:"aud,omitempty"`
+}
+
+const (
+	tokenTypeAccess  = "access_token"
+	tokenTypeRefresh = "refresh_token"
+)
+
+// MakeIntrospectHandler reports whether an access token (JWT) or refresh token
+// (opaque) is active. Callers must be authenticated separately; see
+// middleware.RequireClientAuth. Refresh tokens are judged by the same session
+// limits pol sets for the refresh endpoint.
+func MakeIntrospectHandler(us store.UserStore, tm *token.TokenManager, pol policy.Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(map[string]string{"error": "method_not_allowed"})
+			return
+		}
+
+		req, err := readTokenRequest(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_request"})
+			return
+		}
+		if req.Token == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "token_required"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		defer cancel()
+
+		// token_type_hint is advisory: verifying a JWT needs no store round-trip,
+		// so access tokens are always tried first.
+		resp, err := introspectAccessToken(ctx, tm, req.Token)
+		if err == nil && resp == nil {
+			resp, err = introspectRefreshToken(ctx, us, pol, req.Token)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "internal_error"})
+			return
+		}
+		if resp == nil {
+			resp = &IntrospectionResponse{Active: false}
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// introspectAccessToken returns nil if raw is not a valid access token. A
+// revoked access token is reported inactive rather than falling through to
+// the refresh token lookup.
+func introspectAccessToken(ctx context.Context, tm *token.TokenManager, raw string) (*IntrospectionResponse, error) {
+	claims, err := tm.VerifyAccessToken(raw, "")
+	if err != nil {
+		return nil, nil
+	}
+	revoked, err := tm.IsAccessTokenRevoked(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return &IntrospectionResponse{Active: false}, nil
+	}
+	resp := &IntrospectionResponse{
+		Active:    true,
+		Sub:       claims.Subject,
+		Username:  claims.Username,
+		Scope:     strings.Join(claims.Scopes, " "),
+		TokenType: tokenTypeAccess,
+		Iss:       claims.Issuer,
+		Aud:       strings.Join(claims.Audience, " "),
+	}
+	if claims.ExpiresAt != nil {
+		resp.Exp = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		resp.Iat = claims.IssuedAt.Unix()
+	}
+	return resp, nil
+}
+
+// introspectRefreshToken returns nil if raw is not a known, live refresh token.
+// Tokens whose session has expired, and tokens of deleted (including
+// soft-deleted) or disabled users, are reported inactive.
+func introspectRefreshToken(ctx context.Context, us store.UserStore, pol policy.Policy, raw string) (*IntrospectionResponse, error) {
+	rt, err := us.GetRefreshTokenByHash(ctx, token.HashRefreshToken(raw))
+	if err != nil {
+		return nil, err
+	}
+	if rt == nil || rt.Revoked || rt.ExpiresAt.Before(time.Now()) {
+		return nil, nil
+	}
+	if session, started := sessionOf(pol, rt); session.Expired(started, rt.CreatedAt, time.Now()) {
+		return &IntrospectionResponse{Active: false}, nil
+	}
+	user, err := us.GetUserByID(ctx, rt.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.Disabled || user.DeletedAt != nil {
+		return &IntrospectionResponse{Active: false}, nil
+	}
+	return &IntrospectionResponse{
+		Active:    true,
+		Sub:       strconv.FormatInt(rt.UserID, 10),
+		Username:  user.Username,
+		Exp:       rt.ExpiresAt.Unix(),
+		Iat:       rt.CreatedAt.Unix(),
+		TokenType: tokenTypeRefresh,
+	}, nil
+}
+
+// readTokenRequest decodes a TokenRequest from a form or JSON body.
+func readTokenRequest(r *http.Request) (TokenRequest, error) {
+	var req TokenRequest
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if ct == "application/x-www-form-urlencoded" {
+		if err := r.ParseForm(); err != nil {
+			return req, err
+		}
+		req.Token = r.PostForm.Get("token")
+		req.TokenTypeHint = r.PostForm.Get("token_type_hint")
+		req.RevokeChain, _ = strconv.ParseBool(r.PostForm.Get("revoke_chain"))
+		return req, nil
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	return req, err
+}
@@ -3,19 +3,33 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"log"
+	"net"
 	"net/http"
+	"strings"
 	"time"
+	"unicode/utf8"
 
-	"golang.org/x/crypto/bcrypt"
-
+	"github.com/prfc0/authN/internal/model"
+	"github.com/prfc0/authN/internal/password"
+	"github.com/prfc0/authN/internal/policy"
 	"github.com/prfc0/authN/internal/store"
 	"github.com/prfc0/authN/internal/token"
+	"github.com/prfc0/authN/internal/username"
 )
 
-// LoginRequest matches the register request fields for username/password
+// LoginRequest matches the register request fields for username/password.
+// Audience optionally selects which service the access token is for, and
+// ClientType which lifetimes apply (e.g. "web", "mobile"). RememberMe asks for
+// a long-lived refresh token, and DeviceName labels the session in the
+// sessions API.
 type LoginRequest struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	Audience   string `json:"audience,omitempty"`
+	ClientType string `json:"client_type,omitempty"`
+	RememberMe bool   `json:"remember_me,omitempty"`
+	DeviceName string `json:"device_name,omitempty"`
 }
 
 type LoginResponse struct {
@@ -24,13 +38,16 @@ type LoginResponse struct {
 	AccessExpiresIn  int64  `json:"access_expires_in"`
 	RefreshToken     string `json:"refresh_token"`
 	RefreshExpiresIn int64  `json:"refresh_expires_in"`
+	SessionExpiresIn int64  `json:"session_expires_in,omitempty"`
 }
 
 // MakeLoginHandler returns an http.Handler that authenticates a user and issues tokens.
 // - us: UserStore to lookup user and verify password
 // - tm: TokenManager for creating JWT
-// - db: *sql.DB where refresh tokens will be stored (StoreRefreshToken helper)
-func MakeLoginHandler(us store.UserStore, tm *token.TokenManager) http.HandlerFunc {
+// - pol: token lifetimes and session limits
+// - pw: verifies passwords; outdated hashes are upgraded on success
+// - requireVerifiedEmail: refuse users who have not verified their email
+func MakeLoginHandler(us store.UserStore, tm *token.TokenManager, pol policy.Policy, pw *password.Manager, requireVerifiedEmail bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			w.WriteHeader(http.StatusMethodNotAllowed)
@@ -44,17 +61,26 @@ func MakeLoginHandler(us store.UserStore, tm *token.TokenManager) http.HandlerFu
 			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_json"})
 			return
 		}
-		req.Username = trim(req.Username)
-		req.Password = trim(req.Password)
-		if req.Username == "" || req.Password == "" {
+		name := username.Canonicalize(req.Username)
+		if name.Canonical == "" || req.Password == "" {
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(map[string]string{"error": "username_and_password_required"})
 			return
 		}
+		if _, err := tm.ResolveAudience(req.Audience); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_audience"})
+			return
+		}
+		if !pol.KnownClientType(req.ClientType) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client_type"})
+			return
+		}
 
 		ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
 		defer cancel()
-		user, err := us.GetUserByUsername(ctx, req.Username)
+		user, err := us.GetUserByUsername(ctx, name)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(map[string]string{"error": "internal_error"})
@@ -67,29 +93,88 @@ func MakeLoginHandler(us store.UserStore, tm *token.TokenManager) http.HandlerFu
 		}
 
 		// verify password
-		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		ok, rehash, err := pw.Verify(req.Password, user.Password)
+		if err != nil {
+			log.Printf("login: verify password of user %d: %v", user.ID, err)
+		}
+		if !ok {
 			w.WriteHeader(http.StatusUnauthorized)
 			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_credentials"})
 			return
 		}
+		if rehash {
+			// a failed upgrade is retried on the next login
+			if hash, err := pw.Hash(req.Password); err != nil {
+				log.Printf("login: rehash password of user %d: %v", user.ID, err)
+			} else if err := us.UpdatePasswordHash(ctx, user.ID, hash); err != nil {
+				log.Printf("login: store rehashed password of user %d: %v", user.ID, err)
+			}
+		}
+		if user.Disabled {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"error": "account_disabled"})
+			return
+		}
+		if user.DeletedAt != nil {
+			// the password is right, so the owner may learn it can be restored
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"error": "account_deleted"})
+			return
+		}
+		if requireVerifiedEmail && !user.EmailVerified {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"error": "email_not_verified"})
+			return
+		}
 
-		// 1) create access token (JWT) — TTL 900s
-		access, err := tm.GenerateAccessToken(user.ID, user.Username, 900)
+		// 1) create access token (JWT)
+		claims, err := tm.BuildClaims(ctx, user)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "token_generation_failed"})
+			return
+		}
+		// each login starts a new refresh token family (session)
+		familyID, err := token.NewSessionID()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "token_generation_failed"})
+			return
+		}
+		claims.SessionID = familyID
+		now := time.Now()
+		claims.AuthTime = now
+		claims.AMR = []string{"pwd"}
+		// roles come from the enricher, so lifetimes are resolved from the claims
+		lifetimes := pol.Tokens.Resolve(req.ClientType, claims.Roles, req.RememberMe)
+		access, err := tm.GenerateAccessToken(claims, req.Audience, int64(lifetimes.AccessTTL.Seconds()))
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(map[string]string{"error": "token_generation_failed"})
 			return
 		}
 
-		// 2) create refresh token (opaque) — TTL 1 day
+		// 2) create refresh token (opaque)
 		raw, hash, err := token.GenerateRefreshToken()
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(map[string]string{"error": "token_generation_failed"})
 			return
 		}
-		expires := time.Now().Add(24 * time.Hour)
-		if err := us.StoreRefreshToken(ctx, user.ID, hash, expires); err != nil {
+		session := pol.Session(req.ClientType)
+		expires := session.RefreshExpiry(now, now, lifetimes.RefreshTTL)
+		if _, err := us.CreateRefreshToken(ctx, &model.RefreshToken{
+			UserID:           user.ID,
+			TokenHash:        hash,
+			ExpiresAt:        expires,
+			FamilyID:         familyID,
+			ClientType:       req.ClientType,
+			SessionStartedAt: now,
+			RememberMe:       req.RememberMe,
+			DeviceInfo:       deviceName(req.DeviceName),
+			UserAgent:        truncate(r.UserAgent(), 256),
+			ClientIP:         clientIP(r),
+		}); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(map[string]string{"error": "internal_error"})
 			return
@@ -98,14 +183,44 @@ func MakeLoginHandler(us store.UserStore, tm *token.TokenManager) http.HandlerFu
 		resp := LoginResponse{
 			UserID:           user.ID,
 			AccessToken:      access,
-			AccessExpiresIn:  900,
+			AccessExpiresIn:  int64(lifetimes.AccessTTL.Seconds()),
 			RefreshToken:     raw,
-			RefreshExpiresIn: 86400,
+			RefreshExpiresIn: int64(expires.Sub(now).Seconds()),
+		}
+		if end := session.ExpiresAt(now); !end.IsZero() {
+			resp.SessionExpiresIn = int64(end.Sub(now).Seconds())
 		}
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(resp)
 	}
 }
 
-// small helper trim (replace with your existing helper in project)
-func trim(s string) string { return s }
+// deviceName returns the trimmed client-supplied device name, or nil if none.
+func deviceName(name string) *string {
+	name = truncate(strings.TrimSpace(name), 64)
+	if name == "" {
+		return nil
+	}
+	return &name
+}
+
+// clientIP returns the address of the connecting peer. Proxy headers are not
+// trusted.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// truncate cuts s to at most n bytes without splitting a UTF-8 sequence.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
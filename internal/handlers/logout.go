@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/prfc0/authN/internal/middleware"
+	"github.com/prfc0/authN/internal/store"
+	"github.com/prfc0/authN/internal/token"
+)
+
+// LogoutRequest expects { "refresh_token": "<raw>" }
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// MakeLogoutHandler ends the session that owns the presented refresh token by
+// revoking it and anything it was rotated into. If the request also carries a
+// bearer access token, that token is revoked as well. Logging out twice is not an error.
+func MakeLogoutHandler(us store.UserStore, tm *token.TokenManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(map[string]string{"error": "method_not_allowed"})
+			return
+		}
+
+		var req LogoutRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_json"})
+			return
+		}
+		if req.RefreshToken == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "refresh_token_required"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		defer cancel()
+
+		if err := revokeRefreshToken(ctx, us, req.RefreshToken, true); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "internal_error"})
+			return
+		}
+		if raw, ok := middleware.BearerToken(r); ok {
+			if claims, err := tm.VerifyAccessToken(raw, ""); err == nil {
+				if err := tm.RevokeAccessToken(ctx, claims); err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					json.NewEncoder(w).Encode(map[string]string{"error": "internal_error"})
+					return
+				}
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"status": "logged_out"})
+	}
+}
+
+// MakeLogoutAllHandler revokes every refresh token of the authenticated user and
+// invalidates all access tokens issued so far, ending their sessions on all
+// devices. It must sit behind middleware.RequireAuth.
+func MakeLogoutAllHandler(us store.UserStore, tm *token.TokenManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(map[string]string{"error": "method_not_allowed"})
+			return
+		}
+
+		claims, ok := middleware.ClaimsFromContext(r.Context())
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_token"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		defer cancel()
+
+		userID := claims.UserID
+		if err := us.RevokeAllRefreshTokensForUser(ctx, userID); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "internal_error"})
+			return
+		}
+		if err := tm.RevokeAccessTokensForUser(ctx, userID); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "internal_error"})
+			return
+		}
+		// the cutoff spares tokens issued within its second, possibly this one
+		if err := tm.RevokeAccessToken(ctx, claims); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "internal_error"})
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"status": "logged_out"})
+	}
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/prfc0/authN/internal/mail"
+	"github.com/prfc0/authN/internal/model"
+	"github.com/prfc0/authN/internal/notify"
+	"github.com/prfc0/authN/internal/password"
+	"github.com/prfc0/authN/internal/store"
+	"github.com/prfc0/authN/internal/token"
+	"github.com/prfc0/authN/internal/username"
+)
+
+// PasswordReset configures self-service password resets.
+type PasswordReset struct {
+	Notifier notify.Notifier
+	// LinkURL is the page where users choose the new password; the token is
+	// added as the "token" query parameter.
+	LinkURL string
+	TTL     time.Duration
+}
+
+// ForgotPasswordRequest names the account by username or email address.
+type ForgotPasswordRequest struct {
+	Username string `json:"username,omitempty"`
+	Email    string `json:"email,omitempty"`
+}
+
+// ResetPasswordRequest carries the token from the reset link.
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// MakeForgotPasswordHandler sends a reset link to the named account. The
+// response is the same whether or not the account exists or can be reached,
+// and delivery happens after it is sent.
+func MakeForgotPasswordHandler(us store.UserStore, pr PasswordReset) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(map[string]string{"error": "method_not_allowed"})
+			return
+		}
+
+		var req ForgotPasswordRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_json"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		defer cancel()
+
+		var user *model.User
+		var err error
+		switch {
+		case strings.TrimSpace(req.Email) != "":
+			email, nerr := mail.NormalizeAddress(req.Email)
+			if nerr != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid_email"})
+				return
+			}
+			user, err = us.GetUserByEmail(ctx, email)
+		case strings.TrimSpace(req.Username) != "":
+			user, err = us.GetUserByUsername(ctx, username.Canonicalize(req.Username))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "username_or_email_required"})
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "internal_error"})
+			return
+		}
+
+		if user != nil && !user.Disabled && user.DeletedAt == nil {
+			if err := pr.sendLink(ctx, us, user); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(map[string]string{"error": "internal_error"})
+				return
+			}
+		}
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"status": "sent"})
+	}
+}
+
+// sendLink issues a reset token, superseding earlier ones, and hands the link
+// to the notifier in the background. Only the token's hash is stored.
+func (pr PasswordReset) sendLink(ctx context.Context, us store.UserStore, user *model.User) error {
+	raw, hash, err := token.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+	err = us.CreateOneTimeToken(ctx, &model.OneTimeToken{
+		ID:        hash,
+		UserID:    user.ID,
+		Purpose:   token.PurposePasswordReset,
+		ExpiresAt: time.Now().Add(pr.TTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	link, err := url.Parse(pr.LinkURL)
+	if err != nil {
+		return err
+	}
+	q := link.Query()
+	q.Set("token", raw)
+	link.RawQuery = q.Encode()
+	inBackground(fmt.Sprintf("password reset for user %d", user.ID), func(ctx context.Context) error {
+		return pr.Notifier.PasswordReset(ctx, user, link.String(), pr.TTL)
+	})
+	return nil
+}
+
+// MakeResetPasswordHandler sets a new password from a reset token. The
+// password must satisfy pw's policy; the token is only used up once it does.
+// Every session of the user is then ended.
+func MakeResetPasswordHandler(us store.UserStore, tm *token.TokenManager, pw *password.Manager, n notify.Notifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(ErrorResp{Error: "method_not_allowed"})
+			return
+		}
+
+		var req ResetPasswordRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResp{Error: "invalid_json"})
+			return
+		}
+		if req.Token == "" || req.Password == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResp{Error: "token_and_password_required"})
+			return
+		}
+		hash := token.HashOpaqueToken(req.Token)
+
+		ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		defer cancel()
+
+		ott, err := us.GetOneTimeToken(ctx, hash, token.PurposePasswordReset)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(ErrorResp{Error: "internal_error"})
+			return
+		}
+		var user *model.User
+		if ott != nil {
+			if user, err = us.GetUserByID(ctx, ott.UserID); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(ErrorResp{Error: "internal_error"})
+				return
+			}
+		}
+		if user == nil || user.Disabled || user.DeletedAt != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResp{Error: "invalid_token"})
+			return
+		}
+
+		violations, err := pw.Validate(ctx, req.Password, username.Canonicalize(user.Username).Canonical)
+		if err != nil {
+			log.Printf("password reset: breached password check: %v", err)
+		}
+		if len(violations) > 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResp{Error: "password_policy_violation", Details: violations})
+			return
+		}
+		newHash, err := pw.Hash(req.Password)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(ErrorResp{Error: "internal_error"})
+			return
+		}
+
+		// a concurrent reset with the same token may have won since the lookup
+		if ott, err = us.ConsumeOneTimeToken(ctx, hash, token.PurposePasswordReset); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(ErrorResp{Error: "internal_error"})
+			return
+		}
+		if ott == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResp{Error: "invalid_token"})
+			return
+		}
+		if err := endSessionsWithNewPassword(ctx, us, tm, user.ID, newHash); err != nil {
+			log.Printf("password reset for user %d: %v", user.ID, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(ErrorResp{Error: "internal_error"})
+			return
+		}
+		notifyPasswordChanged(n, user)
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"status": "password_reset"})
+	}
+}
+
+// notifyPasswordChanged tells user about the change in the background, if
+// they can be reached.
+func notifyPasswordChanged(n notify.Notifier, user *model.User) {
+	inBackground(fmt.Sprintf("password changed notice for user %d", user.ID), func(ctx context.Context) error {
+		err := n.PasswordChanged(ctx, user)
+		if errors.Is(err, notify.ErrUnreachable) {
+			return nil
+		}
+		return err
+	})
+}
+
+// endSessionsWithNewPassword stores the new password hash and revokes every
+// refresh and access token of the user, so that whoever knew the old
+// password is signed out.
+func endSessionsWithNewPassword(ctx context.Context, us store.UserStore, tm *token.TokenManager, userID int64, passwordHash string) error {
+	if err := us.UpdatePasswordHash(ctx, userID, passwordHash); err != nil {
+		return err
+	}
+	if err := us.RevokeAllRefreshTokensForUser(ctx, userID); err != nil {
+		return err
+	}
+	return tm.RevokeAccessTokensForUser(ctx, userID)
+}
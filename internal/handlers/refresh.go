@@ -2,32 +2,40 @@ package handlers
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
+	"github.com/prfc0/authN/internal/model"
+	"github.com/prfc0/authN/internal/policy"
 	"github.com/prfc0/authN/internal/store"
 	"github.com/prfc0/authN/internal/token"
 )
 
-// RefreshRequest expects { "refresh_token": "<raw>" }
+// RefreshRequest expects { "refresh_token": "<raw>" } and optionally an audience.
 type RefreshRequest struct {
 	RefreshToken string `json:"refresh_token"`
+	Audience     string `json:"audience,omitempty"`
 }
 
-// RefreshResponse returns new access + refresh tokens
+// RefreshResponse returns new access + refresh tokens. SessionExpiresIn is the
+// remaining absolute session lifetime; it is omitted when the session has none.
 type RefreshResponse struct {
 	UserID           int64  `json:"user_id"`
 	AccessToken      string `json:"access_token"`
 	AccessExpiresIn  int64  `json:"access_expires_in"`
 	RefreshToken     string `json:"refresh_token"`
 	RefreshExpiresIn int64  `json:"refresh_expires_in"`
+	SessionExpiresIn int64  `json:"session_expires_in,omitempty"`
 }
 
-// MakeRefreshHandler creates handler that rotates refresh tokens.
-func MakeRefreshHandler(us store.UserStore, tm *token.TokenManager) http.HandlerFunc {
+// MakeRefreshHandler creates handler that rotates refresh tokens, with
+// lifetimes taken from pol. Successors never outlive the session. Presenting a token again
+// within grace of its rotation returns the same successor; zero disables the
+// grace period.
+func MakeRefreshHandler(us store.UserStore, tm *token.TokenManager, pol policy.Policy, grace time.Duration) http.HandlerFunc {
+	rotations := newRotationCache(grace)
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			w.WriteHeader(http.StatusMethodNotAllowed)
@@ -46,10 +54,14 @@ func MakeRefreshHandler(us store.UserStore, tm *token.TokenManager) http.Handler
 			json.NewEncoder(w).Encode(map[string]string{"error": "refresh_token_required"})
 			return
 		}
+		if _, err := tm.ResolveAudience(req.Audience); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_audience"})
+			return
+		}
 
 		// hash incoming token
-		h := sha256.Sum256([]byte(req.RefreshToken))
-		hashHex := hex.EncodeToString(h[:])
+		hashHex := token.HashRefreshToken(req.RefreshToken)
 
 		ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
 		defer cancel()
@@ -67,48 +79,135 @@ func MakeRefreshHandler(us store.UserStore, tm *token.TokenManager) http.Handler
 			return
 		}
 
-		// if token is already revoked -> reuse detected => revoke all and fail
-		if rt.Revoked {
+		// a retry or parallel refresh of a token rotated within the grace
+		// period gets the same successor back instead of tripping reuse detection
+		rot, leader := rotations.begin(hashHex)
+		if leader {
+			defer rotations.finish(hashHex, rot)
+		}
+		var successor *model.RefreshToken
+		if !leader && rot.wait(ctx) {
+			successor, err = graceSuccessor(ctx, us, hashHex, rot)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(map[string]string{"error": "internal_error"})
+				return
+			}
+			if successor != nil {
+				rt = successor
+			}
+		}
+
+		if successor == nil {
+			// re-read: a concurrent refresh may have rotated the token meanwhile
+			if !leader {
+				if rt, err = us.GetRefreshTokenByHash(ctx, hashHex); err != nil || rt == nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					json.NewEncoder(w).Encode(map[string]string{"error": "internal_error"})
+					return
+				}
+			}
+
+			// if token is already revoked -> reuse detected => revoke its family and fail
+			if rt.Revoked {
+				revokeReusedFamily(ctx, us, r, rt)
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid_refresh_token"})
+				return
+			}
+
+			// session past its absolute lifetime or idle timeout
+			if session, started := sessionOf(pol, rt); session.Expired(started, rt.CreatedAt, time.Now()) {
+				_ = us.MarkRefreshTokenRevokedAndSetReplacement(ctx, rt.ID, 0)
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(map[string]string{"error": "session_expired"})
+				return
+			}
+
+			// if expired
+			if rt.ExpiresAt.Before(time.Now()) {
+				_ = us.MarkRefreshTokenRevokedAndSetReplacement(ctx, rt.ID, 0)
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(map[string]string{"error": "refresh_token_expired"})
+				return
+			}
+		}
+
+		session, started := sessionOf(pol, rt)
+
+		// the user may have been deleted or disabled since the token was issued
+		user, err := us.GetUserByID(ctx, rt.UserID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "internal_error"})
+			return
+		}
+		if user == nil || user.DeletedAt != nil {
 			_ = us.RevokeAllRefreshTokensForUser(ctx, rt.UserID)
 			w.WriteHeader(http.StatusUnauthorized)
 			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_refresh_token"})
 			return
 		}
-
-		// if expired
-		if rt.ExpiresAt.Before(time.Now()) {
-			_ = us.MarkRefreshTokenRevokedAndSetReplacement(ctx, rt.ID, 0)
-			w.WriteHeader(http.StatusUnauthorized)
-			json.NewEncoder(w).Encode(map[string]string{"error": "refresh_token_expired"})
+		if user.Disabled {
+			_ = us.RevokeAllRefreshTokensForUser(ctx, rt.UserID)
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"error": "account_disabled"})
 			return
 		}
 
-		// all good -> rotate: create new refresh token
-		newRaw, newHash, err := token.GenerateRefreshToken()
+		// claims come from the current user record; their roles pick the lifetimes
+		claims, err := tm.BuildClaims(ctx, user)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(map[string]string{"error": "token_generation_failed"})
 			return
 		}
-		newExpires := time.Now().Add(24 * time.Hour)
-		newID, err := us.CreateRefreshToken(ctx, rt.UserID, newHash, newExpires, nil)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]string{"error": "internal_error"})
-			return
-		}
+		claims.SessionID = rt.FamilyID
+		lifetimes := pol.Tokens.Resolve(rt.ClientType, claims.Roles, rt.RememberMe)
 
-		// mark old revoked and set replacement
-		if err := us.MarkRefreshTokenRevokedAndSetReplacement(ctx, rt.ID, newID); err != nil {
-			// best-effort: try to revoke the new token to avoid orphan; but return error for now.
-			_ = us.RevokeAllRefreshTokensForUser(ctx, rt.UserID)
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]string{"error": "internal_error"})
-			return
+		var newRaw string
+		var newExpires time.Time
+		if successor != nil {
+			newRaw, newExpires = rot.successorRaw, successor.ExpiresAt
+		} else {
+			// all good -> rotate: create new refresh token
+			var newHash string
+			newRaw, newHash, err = token.GenerateRefreshToken()
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(map[string]string{"error": "token_generation_failed"})
+				return
+			}
+			newExpires = session.RefreshExpiry(started, time.Now(), lifetimes.RefreshTTL)
+			newID, err := us.RotateRefreshToken(ctx, rt.ID, &model.RefreshToken{
+				UserID:           rt.UserID,
+				TokenHash:        newHash,
+				ExpiresAt:        newExpires,
+				DeviceInfo:       rt.DeviceInfo,
+				FamilyID:         rt.FamilyID,
+				ClientType:       rt.ClientType,
+				SessionStartedAt: started,
+				RememberMe:       rt.RememberMe,
+				UserAgent:        rt.UserAgent,
+				ClientIP:         rt.ClientIP,
+			})
+			if errors.Is(err, store.ErrRefreshTokenReused) {
+				// rotated elsewhere (another instance, or after the grace period) -> treat as reuse
+				revokeReusedFamily(ctx, us, r, rt)
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid_refresh_token"})
+				return
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(map[string]string{"error": "internal_error"})
+				return
+			}
+			rot.successorID, rot.successorRaw, rot.successorHash = newID, newRaw, newHash
 		}
 
 		// create a new access token (JWT)
-		accessToken, err := tm.GenerateAccessToken(rt.UserID, "", 900) // username optional here
+		accessToken, err := tm.GenerateAccessToken(claims, req.Audience, int64(lifetimes.AccessTTL.Seconds()))
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(map[string]string{"error": "token_generation_failed"})
@@ -118,11 +217,58 @@ func MakeRefreshHandler(us store.UserStore, tm *token.TokenManager) http.Handler
 		resp := RefreshResponse{
 			UserID:           rt.UserID,
 			AccessToken:      accessToken,
-			AccessExpiresIn:  900,
+			AccessExpiresIn:  int64(lifetimes.AccessTTL.Seconds()),
 			RefreshToken:     newRaw,
-			RefreshExpiresIn: 86400,
+			RefreshExpiresIn: int64(time.Until(newExpires).Seconds()),
+		}
+		if end := session.ExpiresAt(started); !end.IsZero() {
+			resp.SessionExpiresIn = int64(time.Until(end).Seconds())
 		}
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(resp)
 	}
 }
+
+// graceSuccessor returns the successor recorded in rot if the rotated token
+// still points at it through replaced_by and it is still live; nil otherwise.
+func graceSuccessor(ctx context.Context, us store.UserStore, tokenHash string, rot *rotation) (*model.RefreshToken, error) {
+	old, err := us.GetRefreshTokenByHash(ctx, tokenHash)
+	if err != nil || old == nil {
+		return nil, err
+	}
+	if old.ReplacedBy == nil || *old.ReplacedBy != rot.successorID {
+		return nil, nil
+	}
+	next, err := us.GetRefreshTokenByHash(ctx, rot.successorHash)
+	if err != nil || next == nil {
+		return nil, err
+	}
+	if next.ID != rot.successorID || next.Revoked || next.ExpiresAt.Before(time.Now()) {
+		return nil, nil
+	}
+	return next, nil
+}
+
+// sessionOf returns the session policy for rt's family and when the family
+// started. Rows from before sessions were tracked count from their own creation.
+func sessionOf(pol policy.Policy, rt *model.RefreshToken) (policy.Session, time.Time) {
+	session := pol.Session(rt.ClientType)
+	started := rt.SessionStartedAt
+	if started.IsZero() {
+		started = rt.CreatedAt
+	}
+	return session, started
+}
+
+// revokeReusedFamily handles a rotated refresh token being presented again: the
+// token has leaked, so the session it belongs to is ended and a security event
+// is emitted. Tokens issued before families existed fall back to revoking
+// every token of the user.
+func revokeReusedFamily(ctx context.Context, us store.UserStore, r *http.Request, rt *model.RefreshToken) {
+	if rt.FamilyID != "" {
+		_ = us.RevokeRefreshTokenFamily(ctx, rt.FamilyID)
+	} else {
+		_ = us.RevokeAllRefreshTokensForUser(ctx, rt.UserID)
+	}
+	emitSecurityEvent(newSecurityEvent(eventRefreshTokenReuse, r, rt))
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rotationCache remembers, for a short grace period, the successor issued when
+// a refresh token was rotated. A client that retries the same refresh, or
+// fires several refreshes in parallel, gets that successor back instead of
+// tripping reuse detection.
+//
+// Raw successor tokens are only held in memory: after a restart, or on another
+// instance, a retry falls back to normal reuse detection.
+type rotationCache struct {
+	grace   time.Duration
+	mu      sync.Mutex
+	entries map[string]*rotation // keyed by hash of the rotated token
+}
+
+// rotation is one in-flight or completed rotation. Fields other than done are
+// written by the leader before done is closed.
+type rotation struct {
+	done          chan struct{}
+	finishedAt    time.Time
+	successorID   int64
+	successorRaw  string
+	successorHash string
+}
+
+func newRotationCache(grace time.Duration) *rotationCache {
+	return &rotationCache{grace: grace, entries: make(map[string]*rotation)}
+}
+
+// begin returns the rotation for tokenHash. leader is true when the caller
+// must perform the rotation itself and then call finish; otherwise another
+// request already has, or is doing so.
+func (c *rotationCache) begin(tokenHash string) (rot *rotation, leader bool) {
+	rot = &rotation{done: make(chan struct{})}
+	if c.grace <= 0 {
+		return rot, true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for h, r := range c.entries {
+		if !r.finishedAt.IsZero() && now.Sub(r.finishedAt) > c.grace {
+			delete(c.entries, h)
+		}
+	}
+	if existing, ok := c.entries[tokenHash]; ok {
+		return existing, false
+	}
+	c.entries[tokenHash] = rot
+	return rot, true
+}
+
+// finish publishes the leader's outcome. A rotation without a successor
+// (rejected token, store error) is dropped so later requests start afresh.
+func (c *rotationCache) finish(tokenHash string, rot *rotation) {
+	if c.grace <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rot.finishedAt = time.Now()
+	if rot.successorID == 0 {
+		delete(c.entries, tokenHash)
+	}
+	close(rot.done)
+}
+
+// wait blocks until the leader finishes and reports whether it produced a successor.
+func (rot *rotation) wait(ctx context.Context) bool {
+	select {
+	case <-rot.done:
+		return rot.successorID != 0
+	case <-ctx.Done():
+		return false
+	}
+}
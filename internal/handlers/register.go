@@ -3,28 +3,46 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/prfc0/authN/internal/mail"
+	"github.com/prfc0/authN/internal/model"
+	"github.com/prfc0/authN/internal/password"
 	"github.com/prfc0/authN/internal/store"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/prfc0/authN/internal/token"
+	"github.com/prfc0/authN/internal/username"
 )
 
 type RegisterRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	// Email is optional unless verification is required; a verification
+	// link is sent to it. It belongs to the account only once verified, so it
+	// is never refused as taken here.
+	Email string `json:"email,omitempty"`
 }
 
 type ErrorResp struct {
 	Error string `json:"error"`
+	// Details lists the failed rules of a password_policy_violation or
+	// invalid_username.
+	Details []password.Violation `json:"details,omitempty"`
 }
 
 type RegisterResp struct {
 	UserID   int64  `json:"user_id"`
 	Username string `json:"username"`
+	Email    string `json:"email,omitempty"`
 }
 
-func MakeRegisterHandler(us store.UserStore) http.HandlerFunc {
+// MakeRegisterHandler creates users whose usernames satisfy names and whose
+// passwords satisfy pw's policy, hashing them with pw. A verification link is
+// mailed to the email address, if one is given.
+func MakeRegisterHandler(us store.UserStore, tm *token.TokenManager, pw *password.Manager, names username.Rules, ev EmailVerification) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			w.WriteHeader(http.StatusMethodNotAllowed)
@@ -38,18 +56,49 @@ func MakeRegisterHandler(us store.UserStore) http.HandlerFunc {
 			json.NewEncoder(w).Encode(ErrorResp{Error: "invalid_json"})
 			return
 		}
-		req.Username = trim(req.Username)
-		req.Password = trim(req.Password)
-		if req.Username == "" || req.Password == "" {
+		if strings.TrimSpace(req.Username) == "" || req.Password == "" {
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(ErrorResp{Error: "username_and_password_required"})
 			return
 		}
+		name, err := names.Parse(req.Username)
+		if err != nil {
+			var e *username.Error
+			errors.As(err, &e)
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResp{Error: "invalid_username",
+				Details: []password.Violation{{Rule: e.Rule, Message: e.Message}}})
+			return
+		}
+		var email string
+		if req.Email != "" {
+			if email, err = mail.NormalizeAddress(req.Email); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(ErrorResp{Error: "invalid_email"})
+				return
+			}
+		} else if ev.Required {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResp{Error: "email_required"})
+			return
+		}
 
-		// check exist
 		ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
 		defer cancel()
-		existing, err := us.GetUserByUsername(ctx, req.Username)
+
+		violations, err := pw.Validate(ctx, req.Password, name.Canonical)
+		if err != nil {
+			// an unavailable breach corpus should not block sign-ups
+			log.Printf("register: breached password check: %v", err)
+		}
+		if len(violations) > 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResp{Error: "password_policy_violation", Details: violations})
+			return
+		}
+
+		// check exist
+		existing, err := us.GetUserByUsername(ctx, name)
 		if err != nil {
 			http.Error(w, `{"error":"internal_error"}`, http.StatusInternalServerError)
 			return
@@ -61,13 +110,13 @@ func MakeRegisterHandler(us store.UserStore) http.HandlerFunc {
 		}
 
 		// hash
-		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		hash, err := pw.Hash(req.Password)
 		if err != nil {
 			http.Error(w, `{"error":"internal_error"}`, http.StatusInternalServerError)
 			return
 		}
 
-		id, err := us.CreateUser(ctx, req.Username, string(hash))
+		id, err := us.CreateUser(ctx, name, email, hash)
 		if err != nil {
 			if err == store.ErrUserExists { // if store returns the sentinel
 				w.WriteHeader(http.StatusConflict)
@@ -77,8 +126,15 @@ func MakeRegisterHandler(us store.UserStore) http.HandlerFunc {
 			http.Error(w, `{"error":"internal_error"}`, http.StatusInternalServerError)
 			return
 		}
+		if email != "" {
+			// the user can ask for another link, so this doesn't fail the sign-up
+			user := &model.User{ID: id, Username: name.Display, PendingEmail: email}
+			if err := ev.sendLink(ctx, us, tm, user, email); err != nil {
+				log.Printf("register: email verification for user %d: %v", id, err)
+			}
+		}
 
 		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(RegisterResp{UserID: id, Username: req.Username})
+		json.NewEncoder(w).Encode(RegisterResp{UserID: id, Username: name.Display, Email: email})
 	}
 }
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/prfc0/authN/internal/store"
+	"github.com/prfc0/authN/internal/token"
+)
+
+// MakeRevokeHandler implements RFC 7009 token revocation. Access tokens are
+// denylisted until they expire; refresh tokens are revoked in the store.
+// As the RFC requires, unknown or already revoked tokens still get 200 so the
+// response reveals nothing about the token.
+func MakeRevokeHandler(us store.UserStore, tm *token.TokenManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(map[string]string{"error": "method_not_allowed"})
+			return
+		}
+
+		req, err := readTokenRequest(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_request"})
+			return
+		}
+		if req.Token == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "token_required"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		defer cancel()
+
+		if claims, verr := tm.VerifyAccessToken(req.Token, ""); verr == nil {
+			err = tm.RevokeAccessToken(ctx, claims)
+		} else {
+			err = revokeRefreshToken(ctx, us, req.Token, req.RevokeChain)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "internal_error"})
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// revokeRefreshToken revokes the row for raw (and the rest of its family, or
+// its successors for tokens without one, if chain is set). Unknown tokens are ignored.
+func revokeRefreshToken(ctx context.Context, us store.UserStore, raw string, chain bool) error {
+	rt, err := us.GetRefreshTokenByHash(ctx, token.HashRefreshToken(raw))
+	if err != nil {
+		return err
+	}
+	if rt == nil {
+		return nil
+	}
+	if chain {
+		if rt.FamilyID != "" {
+			return us.RevokeRefreshTokenFamily(ctx, rt.FamilyID)
+		}
+		return us.RevokeRefreshTokenChain(ctx, rt.ID)
+	}
+	return us.RevokeRefreshToken(ctx, rt.ID)
+}
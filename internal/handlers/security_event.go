@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/prfc0/authN/internal/model"
+)
+
+const eventRefreshTokenReuse = "refresh_token_reuse"
+
+// SecurityEvent records something an operator may need to act on. Events are
+// written to the server log as a single JSON line prefixed "security_event".
+type SecurityEvent struct {
+	Type       string    `json:"type"`
+	Time       time.Time `json:"time"`
+	UserID     int64     `json:"user_id"`
+	FamilyID   string    `json:"family_id,omitempty"`
+	Device     string    `json:"device,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	RemoteAddr string    `json:"remote_addr,omitempty"`
+}
+
+// newSecurityEvent describes an event concerning rt, seen on request r.
+func newSecurityEvent(typ string, r *http.Request, rt *model.RefreshToken) SecurityEvent {
+	ev := SecurityEvent{
+		Type:       typ,
+		Time:       time.Now().UTC(),
+		UserID:     rt.UserID,
+		FamilyID:   rt.FamilyID,
+		UserAgent:  r.UserAgent(),
+		RemoteAddr: r.RemoteAddr,
+	}
+	// the device that started the session, which may differ from the request's
+	if rt.DeviceInfo != nil {
+		ev.Device = *rt.DeviceInfo
+	} else {
+		ev.Device = rt.UserAgent
+	}
+	return ev
+}
+
+func emitSecurityEvent(ev SecurityEvent) {
+	b, err := json.Marshal(ev)
+	if err != nil {
+		log.Printf("security_event %s user_id=%d", ev.Type, ev.UserID)
+		return
+	}
+	log.Printf("security_event %s", b)
+}
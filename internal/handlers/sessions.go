@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/prfc0/authN/internal/middleware"
+	"github.com/prfc0/authN/internal/model"
+	"github.com/prfc0/authN/internal/policy"
+	"github.com/prfc0/authN/internal/store"
+	"github.com/prfc0/authN/internal/token"
+)
+
+// SessionsResponse lists the caller's active sessions.
+type SessionsResponse struct {
+	Sessions []model.Session `json:"sessions"`
+}
+
+// MakeListSessionsHandler returns the authenticated user's active sessions,
+// flagging the one the access token was issued for. It must sit behind
+// middleware.RequireAuth.
+func MakeListSessionsHandler(us store.UserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(map[string]string{"error": "method_not_allowed"})
+			return
+		}
+
+		claims, ok := middleware.ClaimsFromContext(r.Context())
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_token"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		defer cancel()
+
+		sessions, err := us.ListSessions(ctx, claims.UserID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "internal_error"})
+			return
+		}
+		for i := range sessions {
+			sessions[i].Current = claims.SessionID != "" && sessions[i].ID == claims.SessionID
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(SessionsResponse{Sessions: sessions})
+	}
+}
+
+// MakeRevokeSessionHandler ends one of the authenticated user's sessions,
+// named by the {id} path segment: its refresh tokens and every access token
+// issued to it stop working at once. It must sit behind middleware.RequireAuth.
+func MakeRevokeSessionHandler(us store.UserStore, tm *token.TokenManager, pol policy.Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(map[string]string{"error": "method_not_allowed"})
+			return
+		}
+
+		claims, ok := middleware.ClaimsFromContext(r.Context())
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_token"})
+			return
+		}
+		id := r.PathValue("id")
+
+		ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		defer cancel()
+
+		found, err := us.RevokeSession(ctx, claims.UserID, id)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "internal_error"})
+			return
+		}
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "session_not_found"})
+			return
+		}
+		if err := tm.RevokeAccessTokensForSession(ctx, id, time.Now().Add(pol.Tokens.MaxAccessTTL())); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "internal_error"})
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"status": "revoked"})
+	}
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/prfc0/authN/internal/token"
+)
+
+// DiscoveryDocument is the OpenID-style metadata served at
+// /.well-known/openid-configuration.
+type DiscoveryDocument struct {
+	Issuer                           string   `json:"issuer"`
+	JWKSURI                          string   `json:"jwks_uri"`
+	RegistrationEndpoint             string   `json:"registration_endpoint"`
+	TokenEndpoint                    string   `json:"token_endpoint"`
+	RefreshEndpoint                  string   `json:"refresh_endpoint"`
+	IntrospectionEndpoint            string   `json:"introspection_endpoint"`
+	RevocationEndpoint               string   `json:"revocation_endpoint"`
+	SubjectTypesSupported            []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+	IntrospectionEndpointAuthMethods []string `json:"introspection_endpoint_auth_methods_supported"`
+}
+
+// MakeJWKSHandler publishes the public halves of the TokenManager key ring.
+// Responses are cacheable for a few minutes; consumers that see an unknown
+// kid should refetch, which the ETag makes cheap.
+func MakeJWKSHandler(tm *token.TokenManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(map[string]string{"error": "method_not_allowed"})
+			return
+		}
+		writeCacheableJSON(w, r, tm.KeyRing().PublicJWKSet(), "public, max-age=300, must-revalidate")
+	}
+}
+
+// MakeDiscoveryHandler serves the discovery document for issuer. It lists
+// only what the service implements: there is no authorization endpoint, so no
+// response types, and the signing algorithms are those of the keys tm still
+// verifies with, which change as keys rotate.
+func MakeDiscoveryHandler(issuer string, tm *token.TokenManager) http.HandlerFunc {
+	base := strings.TrimRight(issuer, "/")
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(map[string]string{"error": "method_not_allowed"})
+			return
+		}
+		doc := DiscoveryDocument{
+			Issuer:                           issuer,
+			JWKSURI:                          base + "/.well-known/jwks.json",
+			RegistrationEndpoint:             base + "/api/v1/auth/register",
+			TokenEndpoint:                    base + "/api/v1/auth/login",
+			RefreshEndpoint:                  base + "/api/v1/auth/refresh",
+			IntrospectionEndpoint:            base + "/api/v1/auth/introspect",
+			RevocationEndpoint:               base + "/api/v1/auth/revoke",
+			SubjectTypesSupported:            []string{"public"},
+			IDTokenSigningAlgValuesSupported: tm.KeyRing().Algorithms(),
+			IntrospectionEndpointAuthMethods: []string{"client_secret_basic"},
+		}
+		writeCacheableJSON(w, r, doc, "public, max-age=3600")
+	}
+}
+
+// writeCacheableJSON writes v with Cache-Control and a strong ETag, answering
+// 304 when the client already holds the current representation.
+func writeCacheableJSON(w http.ResponseWriter, r *http.Request, v interface{}, cacheControl string) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "internal_error"})
+		return
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(buf.Bytes())
+	}
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/prfc0/authN/internal/token"
+)
+
+func TestDiscoveryDocument(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	ec, err := token.NewSigningKey(priv)
+	if err != nil {
+		t.Fatalf("signing key: %v", err)
+	}
+	tm := token.NewManagerWithKey(token.NewHMACKey([]byte("secret")), nil)
+	h := MakeDiscoveryHandler("https://auth.example.com/", tm)
+
+	get := func() map[string]json.RawMessage {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", rec.Code)
+		}
+		var doc map[string]json.RawMessage
+		if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return doc
+	}
+	algs := func(doc map[string]json.RawMessage) []string {
+		t.Helper()
+		var out []string
+		if err := json.Unmarshal(doc["id_token_signing_alg_values_supported"], &out); err != nil {
+			t.Fatalf("id_token_signing_alg_values_supported: %v", err)
+		}
+		return out
+	}
+
+	doc := get()
+	if got := algs(doc); !slices.Equal(got, []string{"HS256"}) {
+		t.Errorf("algorithms = %v, want [HS256]", got)
+	}
+	// no authorization endpoint, so no response types to advertise
+	if raw, ok := doc["response_types_supported"]; ok {
+		t.Errorf("response_types_supported = %s, want it omitted", raw)
+	}
+	var jwks string
+	json.Unmarshal(doc["jwks_uri"], &jwks)
+	if jwks != "https://auth.example.com/.well-known/jwks.json" {
+		t.Errorf("jwks_uri = %q", jwks)
+	}
+
+	// after a rotation the previous key's algorithm stays listed while it verifies
+	tm.RotateSigningKey(ec)
+	if got := algs(get()); !slices.Equal(got, []string{"ES256", "HS256"}) {
+		t.Errorf("algorithms after rotation = %v, want [ES256 HS256]", got)
+	}
+}
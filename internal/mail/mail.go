@@ -0,0 +1,44 @@
+// Package mail sends the transactional emails of the service, such as
+// address verification links.
+package mail
+
+import (
+	"context"
+	"errors"
+	"net/mail"
+	"strings"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// ErrInvalidAddress is returned by NormalizeAddress.
+var ErrInvalidAddress = errors.New("invalid email address")
+
+// NormalizeAddress validates a bare address such as "Alice@Example.com" and
+// returns it trimmed and lowercased, the form in which addresses are stored
+// and compared. Display names ("Alice <alice@example.com>") are rejected.
+func NormalizeAddress(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if len(s) > 254 {
+		return "", ErrInvalidAddress
+	}
+	a, err := mail.ParseAddress(s)
+	if err != nil || a.Address != s || a.Name != "" {
+		return "", ErrInvalidAddress
+	}
+	at := strings.LastIndexByte(s, '@')
+	if at < 1 || !strings.Contains(s[at+1:], ".") {
+		return "", ErrInvalidAddress
+	}
+	return strings.ToLower(s), nil
+}
@@ -11,16 +11,16 @@ import (
 
 type ctxKey string
 
-const (
-	ctxUserIDKey   ctxKey = "auth_user_id"
-	ctxUsernameKey ctxKey = "auth_username"
-)
+const ctxClaimsKey ctxKey = "auth_claims"
 
 type errResp struct {
 	Error string `json:"error"`
 }
 
-func RequireAuth(tm *token.TokenManager) func(next http.Handler) http.Handler {
+// RequireAuth rejects requests without a valid, unrevoked bearer access token.
+// audience names the protecting service; tokens scoped to another audience are
+// rejected. An empty audience accepts any audience this issuer mints.
+func RequireAuth(tm *token.TokenManager, audience string) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			authz := r.Header.Get("Authorization")
@@ -37,38 +37,57 @@ func RequireAuth(tm *token.TokenManager) func(next http.Handler) http.Handler {
 				return
 			}
 
-			claims, err := tm.VerifyAccessToken(parts[1])
+			claims, err := tm.VerifyAccessToken(parts[1], audience)
 			if err != nil {
 				w.WriteHeader(http.StatusUnauthorized)
 				json.NewEncoder(w).Encode(errResp{Error: "invalid_token"})
 				return
 			}
-
-			// put claims in context (minimal — just username if present)
-			ctx := r.Context()
-			if sub, ok := claims["sub"]; ok {
-				ctx = context.WithValue(ctx, ctxUserIDKey, sub)
+			revoked, err := tm.IsAccessTokenRevoked(r.Context(), claims)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(errResp{Error: "internal_error"})
+				return
 			}
-			if u, ok := claims["username"]; ok {
-				if s, ok := u.(string); ok {
-					ctx = context.WithValue(ctx, ctxUsernameKey, s)
-				}
+			if revoked {
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(errResp{Error: "token_revoked"})
+				return
 			}
 
+			ctx := context.WithValue(r.Context(), ctxClaimsKey, claims)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// BearerToken returns the token from an "Authorization: Bearer" header, if any.
+func BearerToken(r *http.Request) (string, bool) {
+	parts := strings.Fields(r.Header.Get("Authorization"))
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// ClaimsFromContext returns the verified access token claims stored by RequireAuth.
+func ClaimsFromContext(ctx context.Context) (*token.Claims, bool) {
+	c, ok := ctx.Value(ctxClaimsKey).(*token.Claims)
+	return c, ok
+}
+
 func UsernameFromContext(ctx context.Context) (string, bool) {
-	v := ctx.Value(ctxUsernameKey)
-	if s, ok := v.(string); ok {
-		return s, true
+	c, ok := ClaimsFromContext(ctx)
+	if !ok || c.Username == "" {
+		return "", false
 	}
-	return "", false
+	return c.Username, true
 }
 
-func UserIDFromContext(ctx context.Context) (interface{}, bool) {
-	v := ctx.Value(ctxUserIDKey)
-	return v, v != nil
+func UserIDFromContext(ctx context.Context) (int64, bool) {
+	c, ok := ClaimsFromContext(ctx)
+	if !ok {
+		return 0, false
+	}
+	return c.UserID, true
 }
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+)
+
+// RequireClientAuth protects service-to-service endpoints (introspection) with
+// HTTP Basic credentials. clients maps client ID to secret; an empty map
+// rejects every request.
+func RequireClientAuth(clients map[string]string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, secret, ok := r.BasicAuth()
+			want, known := clients[id]
+			if !ok || !known || subtle.ConstantTimeCompare([]byte(secret), []byte(want)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="authN"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(errResp{Error: "invalid_client"})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// OneTimeToken records an issued action token (e.g. an email verification
+// link) so that it can be used only once.
+type OneTimeToken struct {
+	// ID is the token's jti, or for opaque tokens the SHA-256 of the token.
+	ID      string `json:"id"`
+	UserID  int64  `json:"user_id"`
+	Purpose string `json:"purpose"`
+	// Email is the address the token was sent to, if any.
+	Email     string     `json:"email,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+}
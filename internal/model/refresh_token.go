@@ -11,5 +11,21 @@ type RefreshToken struct {
 	ExpiresAt  time.Time `json:"expires_at"`
 	Revoked    bool      `json:"revoked"`
 	ReplacedBy *int64    `json:"replaced_by,omitempty"`
-	DeviceInfo *string   `json:"device_info,omitempty"`
+	// DeviceInfo is the device name the client supplied at login, if any.
+	DeviceInfo *string `json:"device_info,omitempty"`
+	// FamilyID identifies the login session every rotation descends from.
+	// Empty for rows created before families existed.
+	FamilyID string `json:"family_id,omitempty"`
+	// ClientType selects the session policy; empty means the default.
+	ClientType string `json:"client_type,omitempty"`
+	// SessionStartedAt is the login time of the family, copied on rotation.
+	// Zero for rows created before it was recorded.
+	SessionStartedAt time.Time `json:"session_started_at,omitempty"`
+	// RememberMe is set when the session was started with "remember me" and
+	// keeps the longer refresh TTL across rotations.
+	RememberMe bool `json:"remember_me,omitempty"`
+	// UserAgent and ClientIP describe the client that logged in; both are
+	// copied on rotation.
+	UserAgent string `json:"user_agent,omitempty"`
+	ClientIP  string `json:"client_ip,omitempty"`
 }
@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// Session is an active login (refresh token family) as shown to its owner.
+type Session struct {
+	ID         string    `json:"id"`
+	DeviceName string    `json:"device_name,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	ClientIP   string    `json:"client_ip,omitempty"`
+	ClientType string    `json:"client_type,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// Current marks the session the request was made from.
+	Current bool `json:"current"`
+}
@@ -3,8 +3,18 @@ package model
 import "time"
 
 type User struct {
-	ID        int64     `json:"id"`
-	Username  string    `json:"username"`
-	Password  string    `json:"-"` // hashed
-	CreatedAt time.Time `json:"created_at"`
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	Password string `json:"-"` // hashed
+	// Email is the account's verified address; only verified addresses are
+	// unique across users.
+	Email         string `json:"email,omitempty"`
+	EmailVerified bool   `json:"email_verified"`
+	// PendingEmail is an address awaiting verification, given at registration
+	// or requested as a new address; Email stays in use until it is confirmed.
+	PendingEmail string    `json:"pending_email,omitempty"`
+	Disabled     bool      `json:"disabled"`
+	CreatedAt    time.Time `json:"created_at"`
+	// DeletedAt is set while a deleted account can still be restored.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
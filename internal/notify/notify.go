@@ -0,0 +1,51 @@
+// Package notify tells users about security-relevant account events, such as
+// password resets, over whatever channel reaches them.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prfc0/authN/internal/mail"
+	"github.com/prfc0/authN/internal/model"
+)
+
+// ErrUnreachable is returned when the user has no usable channel, e.g. no
+// verified email address.
+var ErrUnreachable = errors.New("user has no verified contact")
+
+// Notifier delivers account notifications to a user.
+type Notifier interface {
+	// PasswordReset sends the link with which user can choose a new password.
+	PasswordReset(ctx context.Context, user *model.User, link string, expiresIn time.Duration) error
+	// PasswordChanged tells user their password was changed.
+	PasswordChanged(ctx context.Context, user *model.User) error
+}
+
+// EmailNotifier notifies users at their verified email address. Unverified
+// addresses are not used: whoever owns one has not proven to own the account.
+type EmailNotifier struct {
+	Mailer mail.Mailer
+}
+
+func (n EmailNotifier) PasswordReset(ctx context.Context, user *model.User, link string, expiresIn time.Duration) error {
+	return n.send(ctx, user, "Reset your password", fmt.Sprintf(
+		"Hi %s,\n\nopen this link to choose a new password:\n\n%s\n\n"+
+			"The link expires in %s. If you did not ask for this, ignore this email; your password is unchanged.\n",
+		user.Username, link, expiresIn))
+}
+
+func (n EmailNotifier) PasswordChanged(ctx context.Context, user *model.User) error {
+	return n.send(ctx, user, "Your password was changed", fmt.Sprintf(
+		"Hi %s,\n\nthe password of your account was just changed.\n"+
+			"If this wasn't you, reset your password now.\n", user.Username))
+}
+
+func (n EmailNotifier) send(ctx context.Context, user *model.User, subject, body string) error {
+	if user.Email == "" || !user.EmailVerified {
+		return ErrUnreachable
+	}
+	return n.Mailer.Send(ctx, mail.Message{To: user.Email, Subject: subject, Body: body})
+}
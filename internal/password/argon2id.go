@@ -0,0 +1,93 @@
+package password
+
+import (
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2id hashes with argon2id (RFC 9106). Memory is in KiB.
+type Argon2id struct {
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+	SaltLen int
+	KeyLen  uint32
+}
+
+// DefaultArgon2id uses the second recommended option of RFC 9106: 64 MiB,
+// three passes, four lanes.
+var DefaultArgon2id = Argon2id{Memory: 64 * 1024, Time: 3, Threads: 4, SaltLen: 16, KeyLen: 32}
+
+// Upper bounds on argon2id parameters, enforced both when configuring a
+// hasher and when decoding a hash, so every hash written can be verified and
+// a tampered hash cannot demand absurd memory or time.
+const (
+	argon2MaxMemory  = 4 << 20 // KiB, i.e. 4 GiB
+	argon2MaxTime    = 100
+	argon2MaxThreads = 255
+)
+
+func (h Argon2id) Identify(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (h Argon2id) Hash(password string) (string, error) {
+	salt, err := randomSalt(h.SaltLen)
+	if err != nil {
+		return "", err
+	}
+	release := acquireHashSlot()
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, h.KeyLen)
+	release()
+	p := &phc{
+		id:      "argon2id",
+		version: strconv.Itoa(argon2.Version),
+		params: map[string]string{
+			"m": strconv.FormatUint(uint64(h.Memory), 10),
+			"t": strconv.FormatUint(uint64(h.Time), 10),
+			"p": strconv.FormatUint(uint64(h.Threads), 10),
+		},
+		salt: salt,
+		hash: key,
+	}
+	return p.encode("m", "t", "p"), nil
+}
+
+func (h Argon2id) Verify(password, encoded string) (bool, error) {
+	p, params, err := h.decode(encoded)
+	if err != nil {
+		return false, err
+	}
+	release := acquireHashSlot()
+	key := argon2.IDKey([]byte(password), p.salt, params.Time, params.Memory, params.Threads, uint32(len(p.hash)))
+	release()
+	return equal(key, p.hash), nil
+}
+
+func (h Argon2id) NeedsRehash(encoded string) bool {
+	p, params, err := h.decode(encoded)
+	if err != nil {
+		return true
+	}
+	return params.Memory != h.Memory || params.Time != h.Time || params.Threads != h.Threads ||
+		len(p.salt) < h.SaltLen || uint32(len(p.hash)) != h.KeyLen
+}
+
+// decode parses encoded, returning the parameters it was made with.
+func (h Argon2id) decode(encoded string) (*phc, Argon2id, error) {
+	var params Argon2id
+	p, err := decodePHC(encoded)
+	if err != nil || p.id != "argon2id" || p.version != strconv.Itoa(argon2.Version) {
+		return nil, params, ErrMalformedHash
+	}
+	m, err1 := p.uint("m", argon2MaxMemory)
+	t, err2 := p.uint("t", argon2MaxTime)
+	threads, err3 := p.uint("p", argon2MaxThreads)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return nil, params, ErrMalformedHash
+	}
+	params.Memory, params.Time, params.Threads = uint32(m), uint32(t), uint8(threads)
+	return p, params, nil
+}
@@ -0,0 +1,221 @@
+package password
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RuleBreached is reported for passwords found by a BreachChecker.
+const RuleBreached = "breached_password"
+
+// BreachChecker looks passwords up in a corpus of breached passwords, such as
+// Have I Been Pwned's Pwned Passwords. Only SHA-1 hashes are compared.
+type BreachChecker interface {
+	// Breached returns how often password appears in the corpus; 0 if never.
+	Breached(ctx context.Context, password string) (int, error)
+}
+
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// BreachCorpus is a local copy of a Pwned Passwords-style corpus, either a
+// single file of "SHA1:COUNT" lines sorted by hash, searched with a binary
+// search, or a directory of per-prefix files ("21BD1.txt" holding
+// "SUFFIX:COUNT" lines) as written by the official downloader.
+type BreachCorpus struct {
+	dir  string
+	f    *os.File
+	size int64
+}
+
+// OpenBreachCorpus opens the corpus file or directory at path.
+func OpenBreachCorpus(path string) (*BreachCorpus, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return &BreachCorpus{dir: path}, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &BreachCorpus{f: f, size: fi.Size()}, nil
+}
+
+// Close releases the corpus file.
+func (c *BreachCorpus) Close() error {
+	if c.f == nil {
+		return nil
+	}
+	return c.f.Close()
+}
+
+func (c *BreachCorpus) Breached(ctx context.Context, password string) (int, error) {
+	hash := sha1Hex(password)
+	if c.dir != "" {
+		return c.lookupPrefixFile(hash)
+	}
+	return c.lookupSorted(hash)
+}
+
+func (c *BreachCorpus) lookupPrefixFile(hash string) (int, error) {
+	f, err := os.Open(filepath.Join(c.dir, hash[:5]+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return scanSuffixes(f, hash[5:])
+}
+
+// lookupSorted finds the first line whose hash is >= hash by binary search
+// over byte offsets, so the file never has to be loaded or indexed.
+func (c *BreachCorpus) lookupSorted(hash string) (int, error) {
+	lo, hi := int64(0), c.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		line, err := c.lineAfter(mid)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if err == io.EOF || strings.ToUpper(lineHash(line)) >= hash {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	line, err := c.lineAfter(lo)
+	if err == io.EOF {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if !strings.EqualFold(lineHash(line), hash) {
+		return 0, nil
+	}
+	return lineCount(line)
+}
+
+// maxLineLen comfortably exceeds "40 hex digits:count\r\n".
+const maxLineLen = 128
+
+// lineAfter returns the first line that starts at or after off.
+func (c *BreachCorpus) lineAfter(off int64) (string, error) {
+	buf := make([]byte, maxLineLen)
+	start := off
+	if off > 0 {
+		// a line starts at off only if the byte before it is a newline
+		n, err := c.f.ReadAt(buf, off-1)
+		if n == 0 {
+			return "", io.EOF
+		}
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		i := strings.IndexByte(string(buf[:n]), '\n')
+		if i < 0 && err == io.EOF {
+			// off is within the last line, which lacks a trailing newline
+			return "", io.EOF
+		}
+		if i < 0 {
+			return "", fmt.Errorf("password: breach corpus line at offset %d too long", off)
+		}
+		start = off + int64(i)
+	}
+	if start >= c.size {
+		return "", io.EOF
+	}
+	n, err := c.f.ReadAt(buf, start)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	line := string(buf[:n])
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	return strings.TrimRight(line, "\r"), nil
+}
+
+func lineHash(line string) string {
+	h, _, _ := strings.Cut(line, ":")
+	return h
+}
+
+func lineCount(line string) (int, error) {
+	_, count, ok := strings.Cut(line, ":")
+	if !ok {
+		return 1, nil
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil {
+		return 0, fmt.Errorf("password: malformed breach corpus line %q", line)
+	}
+	return n, nil
+}
+
+// scanSuffixes reads "SUFFIX:COUNT" lines looking for suffix.
+func scanSuffixes(r io.Reader, suffix string) (int, error) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if strings.EqualFold(lineHash(line), suffix) {
+			return lineCount(line)
+		}
+	}
+	return 0, sc.Err()
+}
+
+// RangeClient queries a Pwned Passwords range API (k-anonymity: only the
+// first five hex digits of the hash leave the process).
+type RangeClient struct {
+	// BaseURL is e.g. "https://api.pwnedpasswords.com"; requests go to
+	// BaseURL + "/range/" + prefix.
+	BaseURL string
+	HTTP    *http.Client
+}
+
+// NewRangeClient returns a RangeClient for baseURL with a short timeout.
+func NewRangeClient(baseURL string) *RangeClient {
+	return &RangeClient{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		HTTP:    &http.Client{Timeout: 3 * time.Second},
+	}
+}
+
+func (c *RangeClient) Breached(ctx context.Context, password string) (int, error) {
+	hash := sha1Hex(password)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/range/"+hash[:5], nil)
+	if err != nil {
+		return 0, err
+	}
+	// padding hides the size of the response from observers
+	req.Header.Set("Add-Padding", "true")
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("password: range API returned %s", resp.Status)
+	}
+	// padding entries have a count of 0
+	return scanSuffixes(io.LimitReader(resp.Body, 4<<20), hash[5:])
+}
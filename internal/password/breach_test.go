@@ -0,0 +1,218 @@
+package password
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestRangeClientBreached(t *testing.T) {
+	const (
+		breached = "password"
+		unknown  = "Zq8-vLm#2rTx"
+		padded   = "correct horse battery staple"
+		failing  = "range API down"
+	)
+	// each password's prefix gets its own response; other suffixes fill them out
+	ranges := map[string]string{
+		sha1Hex(breached)[:5]: "0018A45C4D1DEF81644B54AB7F969B88D65:1\r\n" + sha1Hex(breached)[5:] + ":3861493\r\n",
+		sha1Hex(unknown)[:5]:  "0018A45C4D1DEF81644B54AB7F969B88D65:4\r\n00D4F6E8FA6EECAD2A3AA415EEC418D38EC:2\r\n",
+		sha1Hex(padded)[:5]:   "0018A45C4D1DEF81644B54AB7F969B88D65:7\r\n" + sha1Hex(padded)[5:] + ":0\r\n",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix, ok := strings.CutPrefix(r.URL.Path, "/range/")
+		if !ok || len(prefix) != 5 {
+			t.Errorf("unexpected request path %q", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Add-Padding") != "true" {
+			t.Errorf("request for %s without Add-Padding", prefix)
+		}
+		body, ok := ranges[prefix]
+		if !ok {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+	defer srv.Close()
+
+	c := NewRangeClient(srv.URL + "/")
+	tests := []struct {
+		name     string
+		password string
+		want     int
+		wantErr  bool
+	}{
+		{"hit", breached, 3861493, false},
+		{"miss", unknown, 0, false},
+		{"padding entry", padded, 0, false},
+		{"non-200 response", failing, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.Breached(context.Background(), tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Breached() error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Breached() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// corpusEntry is a password and the count a test corpus lists it with.
+type corpusEntry struct {
+	password string
+	hash     string
+	count    int
+}
+
+// testCorpus returns passwords sorted by hash. The first and last are left out
+// of the corpus, as is the middle one, so lookups can miss below, above and
+// between listed hashes; the others are listed with count i.
+func testCorpus() (listed, missing []corpusEntry) {
+	all := make([]corpusEntry, 40)
+	for i := range all {
+		p := fmt.Sprintf("password-%d", i)
+		all[i] = corpusEntry{password: p, hash: sha1Hex(p)}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].hash < all[j].hash })
+	for i := range all {
+		all[i].count = i * 1000
+		switch i {
+		case 0, len(all) / 2, len(all) - 1:
+			missing = append(missing, all[i])
+		default:
+			listed = append(listed, all[i])
+		}
+	}
+	return listed, missing
+}
+
+func TestBreachCorpusSortedFile(t *testing.T) {
+	listed, missing := testCorpus()
+	variants := []struct {
+		name string
+		line func(e corpusEntry) string
+		eol  string
+	}{
+		{"LF", func(e corpusEntry) string { return fmt.Sprintf("%s:%d", e.hash, e.count) }, "\n"},
+		{"CRLF", func(e corpusEntry) string { return fmt.Sprintf("%s:%d", e.hash, e.count) }, "\r\n"},
+		{"lowercase hex", func(e corpusEntry) string { return fmt.Sprintf("%s:%d", strings.ToLower(e.hash), e.count) }, "\n"},
+		{"padded count", func(e corpusEntry) string { return fmt.Sprintf("%s: %d ", e.hash, e.count) }, "\r\n"},
+	}
+	for _, v := range variants {
+		t.Run(v.name, func(t *testing.T) {
+			var b strings.Builder
+			for i, e := range listed {
+				b.WriteString(v.line(e))
+				if i < len(listed)-1 {
+					// the last line has no newline, as some tools write it
+					b.WriteString(v.eol)
+				}
+			}
+			path := filepath.Join(t.TempDir(), "pwned.txt")
+			if err := os.WriteFile(path, []byte(b.String()), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			c, err := OpenBreachCorpus(path)
+			if err != nil {
+				t.Fatalf("open: %v", err)
+			}
+			defer c.Close()
+
+			for i, e := range listed {
+				got, err := c.Breached(context.Background(), e.password)
+				if err != nil || got != e.count {
+					t.Errorf("line %d of %d: Breached() = %d, %v, want %d", i+1, len(listed), got, err, e.count)
+				}
+			}
+			for _, e := range missing {
+				if got, err := c.Breached(context.Background(), e.password); err != nil || got != 0 {
+					t.Errorf("unlisted %s: Breached() = %d, %v, want 0", e.hash, got, err)
+				}
+			}
+		})
+	}
+}
+
+func TestBreachCorpusSortedFileWithoutCounts(t *testing.T) {
+	listed, _ := testCorpus()
+	var b strings.Builder
+	for _, e := range listed {
+		b.WriteString(e.hash + "\n")
+	}
+	path := filepath.Join(t.TempDir(), "hashes.txt")
+	if err := os.WriteFile(path, []byte(b.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := OpenBreachCorpus(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer c.Close()
+	for _, e := range []corpusEntry{listed[0], listed[len(listed)-1]} {
+		if got, err := c.Breached(context.Background(), e.password); err != nil || got != 1 {
+			t.Errorf("%s: Breached() = %d, %v, want 1", e.hash, got, err)
+		}
+	}
+}
+
+func TestBreachCorpusPrefixDir(t *testing.T) {
+	listed, missing := testCorpus()
+	dir := t.TempDir()
+	files := map[string]*strings.Builder{}
+	for i, e := range listed {
+		b, ok := files[e.hash[:5]]
+		if !ok {
+			// one padding entry per file, as the official downloader writes
+			b = &strings.Builder{}
+			b.WriteString("0000000000000000000000000000000000A:0\r\n")
+			files[e.hash[:5]] = b
+		}
+		suffix := e.hash[5:]
+		if i%2 == 1 {
+			suffix = strings.ToLower(suffix)
+		}
+		fmt.Fprintf(b, "%s:%d\r\n", suffix, e.count)
+	}
+	for prefix, b := range files {
+		if err := os.WriteFile(filepath.Join(dir, prefix+".txt"), []byte(b.String()), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c, err := OpenBreachCorpus(dir)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer c.Close()
+
+	for _, e := range listed {
+		if got, err := c.Breached(context.Background(), e.password); err != nil || got != e.count {
+			t.Errorf("%s: Breached() = %d, %v, want %d", e.hash, got, err, e.count)
+		}
+	}
+	// the missing entries have no prefix file, barring a collision
+	for _, e := range missing {
+		if got, err := c.Breached(context.Background(), e.password); err != nil || got != 0 {
+			t.Errorf("unlisted %s: Breached() = %d, %v, want 0", e.hash, got, err)
+		}
+	}
+	// a prefix file that exists but lacks the suffix
+	e := listed[0]
+	if err := os.WriteFile(filepath.Join(dir, e.hash[:5]+".txt"), []byte("0000000000000000000000000000000000A:3\r\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := c.Breached(context.Background(), e.password); err != nil || got != 0 {
+		t.Errorf("suffix not in its prefix file: Breached() = %d, %v, want 0", got, err)
+	}
+}
@@ -0,0 +1,27 @@
+package password
+
+import "runtime"
+
+// hashSlots bounds how many argon2id and scrypt computations run at once.
+// Each holds its memory parameter (64 MiB for DefaultArgon2id) until it
+// finishes, so without a bound a burst of logins could exhaust memory; callers
+// beyond the bound wait for a slot. Peak memory is about the bound times the
+// largest memory parameter in use.
+var hashSlots = make(chan struct{}, runtime.GOMAXPROCS(0))
+
+// SetMaxConcurrentHashes sets how many argon2id and scrypt hashes may be
+// computed at once; n < 1 restores the default of GOMAXPROCS. Call it before
+// any hashing starts.
+func SetMaxConcurrentHashes(n int) {
+	if n < 1 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	hashSlots = make(chan struct{}, n)
+}
+
+// acquireHashSlot waits for a free slot and returns the function releasing it.
+func acquireHashSlot() func() {
+	slots := hashSlots
+	slots <- struct{}{}
+	return func() { <-slots }
+}
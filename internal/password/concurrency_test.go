@@ -0,0 +1,33 @@
+package password
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHashesWaitForASlot(t *testing.T) {
+	SetMaxConcurrentHashes(1)
+	defer SetMaxConcurrentHashes(0)
+	h := Argon2id{Memory: 64, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32}
+
+	release := acquireHashSlot()
+	done := make(chan error, 1)
+	go func() {
+		_, err := h.Hash("correct horse battery staple")
+		done <- err
+	}()
+	select {
+	case <-done:
+		t.Fatal("hash ran while the only slot was taken")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("hash: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("hash did not run after the slot was freed")
+	}
+}
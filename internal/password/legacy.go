@@ -0,0 +1,189 @@
+package password
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// The verifiers in this file accept hashes imported from other systems. They
+// cannot create hashes; users are moved to the current Hasher on their first
+// successful login.
+
+// DjangoPBKDF2SHA256 verifies Django's "pbkdf2_sha256$iterations$salt$hash".
+type DjangoPBKDF2SHA256 struct{}
+
+func (DjangoPBKDF2SHA256) Identify(encoded string) bool {
+	return strings.HasPrefix(encoded, "pbkdf2_sha256$")
+}
+
+func (DjangoPBKDF2SHA256) Verify(password, encoded string) (bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 {
+		return false, ErrMalformedHash
+	}
+	iter, err := strconv.Atoi(parts[1])
+	if err != nil || iter <= 0 || iter > 10_000_000 {
+		return false, ErrMalformedHash
+	}
+	want, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil || len(want) == 0 {
+		return false, ErrMalformedHash
+	}
+	got := pbkdf2.Key([]byte(password), []byte(parts[2]), iter, len(want), sha256.New)
+	return equal(got, want), nil
+}
+
+// HtpasswdSHA1 verifies Apache htpasswd "{SHA}" hashes (unsalted SHA-1).
+type HtpasswdSHA1 struct{}
+
+func (HtpasswdSHA1) Identify(encoded string) bool {
+	return strings.HasPrefix(encoded, "{SHA}")
+}
+
+func (HtpasswdSHA1) Verify(password, encoded string) (bool, error) {
+	want, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(encoded, "{SHA}"))
+	if err != nil || len(want) != sha1.Size {
+		return false, ErrMalformedHash
+	}
+	got := sha1.Sum([]byte(password))
+	return equal(got[:], want), nil
+}
+
+// APR1MD5 verifies Apache htpasswd "$apr1$salt$hash" (MD5-crypt) hashes.
+type APR1MD5 struct{}
+
+func (APR1MD5) Identify(encoded string) bool {
+	return strings.HasPrefix(encoded, "$apr1$")
+}
+
+func (APR1MD5) Verify(password, encoded string) (bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || len(parts[2]) > 8 || len(parts[3]) != 22 {
+		return false, ErrMalformedHash
+	}
+	got := md5Crypt([]byte(password), []byte(parts[2]), []byte("$apr1$"))
+	return equal([]byte(got), []byte(encoded)), nil
+}
+
+// PHPass verifies portable PHPass hashes ("$P$" as used by WordPress, "$H$"
+// by phpBB).
+type PHPass struct{}
+
+func (PHPass) Identify(encoded string) bool {
+	return strings.HasPrefix(encoded, "$P$") || strings.HasPrefix(encoded, "$H$")
+}
+
+func (PHPass) Verify(password, encoded string) (bool, error) {
+	if len(encoded) != 34 {
+		return false, ErrMalformedHash
+	}
+	countLog2 := strings.IndexByte(itoa64, encoded[3])
+	if countLog2 < 7 || countLog2 > 30 {
+		return false, ErrMalformedHash
+	}
+	salt := encoded[4:12]
+	sum := md5.Sum([]byte(salt + password))
+	for i := 0; i < 1<<countLog2; i++ {
+		sum = md5.Sum(append(sum[:], password...))
+	}
+	got := encoded[:12] + phpassEncode(sum[:])
+	return equal([]byte(got), []byte(encoded)), nil
+}
+
+const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// md5Crypt is the MD5-based crypt(3) algorithm; magic is "$1$" or "$apr1$".
+func md5Crypt(password, salt, magic []byte) string {
+	d := md5.New()
+	d.Write(password)
+	d.Write(magic)
+	d.Write(salt)
+
+	alt := md5.New()
+	alt.Write(password)
+	alt.Write(salt)
+	alt.Write(password)
+	mixin := alt.Sum(nil)
+	for i := len(password); i > 0; i -= 16 {
+		d.Write(mixin[:min(i, 16)])
+	}
+	for i := len(password); i > 0; i >>= 1 {
+		if i&1 == 1 {
+			d.Write([]byte{0})
+		} else {
+			d.Write(password[:1])
+		}
+	}
+	final := d.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		r := md5.New()
+		if i&1 == 1 {
+			r.Write(password)
+		} else {
+			r.Write(final)
+		}
+		if i%3 != 0 {
+			r.Write(salt)
+		}
+		if i%7 != 0 {
+			r.Write(password)
+		}
+		if i&1 == 1 {
+			r.Write(final)
+		} else {
+			r.Write(password)
+		}
+		final = r.Sum(nil)
+	}
+
+	var b strings.Builder
+	b.Write(magic)
+	b.Write(salt)
+	b.WriteByte('$')
+	to64 := func(v uint32, n int) {
+		for ; n > 0; n-- {
+			b.WriteByte(itoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+	for _, g := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		to64(uint32(final[g[0]])<<16|uint32(final[g[1]])<<8|uint32(final[g[2]]), 4)
+	}
+	to64(uint32(final[11]), 2)
+	return b.String()
+}
+
+// phpassEncode is PHPass's little-endian base64 variant.
+func phpassEncode(in []byte) string {
+	var b strings.Builder
+	for i := 0; i < len(in); {
+		v := uint32(in[i])
+		i++
+		b.WriteByte(itoa64[v&0x3f])
+		if i < len(in) {
+			v |= uint32(in[i]) << 8
+		}
+		b.WriteByte(itoa64[(v>>6)&0x3f])
+		if i >= len(in) {
+			break
+		}
+		i++
+		if i < len(in) {
+			v |= uint32(in[i]) << 16
+		}
+		b.WriteByte(itoa64[(v>>12)&0x3f])
+		if i >= len(in) {
+			break
+		}
+		i++
+		b.WriteByte(itoa64[(v>>18)&0x3f])
+	}
+	return b.String()
+}
@@ -0,0 +1,240 @@
+// Package password hashes and verifies user passwords. Hashes are stored as
+// self-describing strings (PHC format, or the algorithm's native format for
+// bcrypt), so several algorithms and parameter sets can coexist and old
+// hashes can be upgraded on login.
+package password
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrUnknownFormat means no registered Verifier recognises the stored hash.
+	ErrUnknownFormat = errors.New("password: unknown hash format")
+	// ErrMalformedHash means the stored hash is recognised but cannot be parsed.
+	ErrMalformedHash = errors.New("password: malformed hash")
+)
+
+// Verifier checks passwords against hashes in one encoded format.
+type Verifier interface {
+	// Identify reports whether encoded is in this verifier's format.
+	Identify(encoded string) bool
+	// Verify reports whether password matches encoded.
+	Verify(password, encoded string) (bool, error)
+}
+
+// Hasher is a Verifier that can also produce new hashes.
+type Hasher interface {
+	Verifier
+	Hash(password string) (string, error)
+	// NeedsRehash reports whether encoded was made with parameters other
+	// than the hasher's current ones.
+	NeedsRehash(encoded string) bool
+}
+
+// Manager hashes new passwords with its current Hasher, verifies stored
+// hashes in any registered format and applies the password Policy.
+type Manager struct {
+	current   Hasher
+	verifiers []Verifier
+	policy    Policy
+	breaches  BreachChecker
+}
+
+// Option configures a Manager.
+type Option func(*Manager)
+
+// WithVerifiers accepts stored hashes in additional formats.
+func WithVerifiers(v ...Verifier) Option {
+	return func(m *Manager) { m.verifiers = append(m.verifiers, v...) }
+}
+
+// WithPolicy replaces DefaultPolicy.
+func WithPolicy(p Policy) Option {
+	return func(m *Manager) { m.policy = p }
+}
+
+// WithBreachChecker rejects new passwords that appear in c.
+func WithBreachChecker(c BreachChecker) Option {
+	return func(m *Manager) { m.breaches = c }
+}
+
+// NewManager returns a Manager that hashes with current and verifies hashes
+// of current, the built-in hashers and the imported legacy formats.
+func NewManager(current Hasher, opts ...Option) *Manager {
+	m := &Manager{current: current, policy: DefaultPolicy}
+	m.verifiers = append(m.verifiers, current, DefaultArgon2id, DefaultBcrypt, DefaultScrypt,
+		DjangoPBKDF2SHA256{}, HtpasswdSHA1{}, APR1MD5{}, PHPass{})
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Recognizes reports whether encoded is in a format the Manager can verify.
+func (m *Manager) Recognizes(encoded string) bool {
+	for _, v := range m.verifiers {
+		if v.Identify(encoded) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks a new password for username against the policy and, if
+// configured, the breach corpus. An error means the breach lookup failed; the
+// policy violations are still returned.
+func (m *Manager) Validate(ctx context.Context, password, username string) ([]Violation, error) {
+	violations := m.policy.Check(password, username)
+	if m.breaches == nil {
+		return violations, nil
+	}
+	for _, v := range violations {
+		if v.Rule == RuleMaxLength {
+			return violations, nil
+		}
+	}
+	n, err := m.breaches.Breached(ctx, m.policy.normalize(password))
+	if err != nil {
+		return violations, err
+	}
+	if n > 0 {
+		violations = append(violations, Violation{RuleBreached, "appears in a known data breach"})
+	}
+	return violations, nil
+}
+
+// Hash hashes password, normalized per the policy, with the current Hasher.
+func (m *Manager) Hash(password string) (string, error) {
+	return m.current.Hash(m.policy.normalize(password))
+}
+
+// Verify reports whether password matches encoded and, if it does, whether
+// encoded should be replaced by a fresh Hash because it uses another
+// algorithm or outdated parameters. The password is tried as normalized and,
+// for hashes imported from systems that did not normalize, as typed; a match
+// on the latter also asks for a rehash.
+func (m *Manager) Verify(password, encoded string) (ok, rehash bool, err error) {
+	var v Verifier
+	for _, c := range m.verifiers {
+		if c.Identify(encoded) {
+			v = c
+			break
+		}
+	}
+	if v == nil {
+		return false, false, ErrUnknownFormat
+	}
+
+	normalized := m.policy.normalize(password)
+	if ok, err = v.Verify(normalized, encoded); err != nil {
+		return false, false, err
+	}
+	if !ok && normalized != password {
+		if ok, err = v.Verify(password, encoded); err != nil || !ok {
+			return false, false, err
+		}
+		return true, true, nil
+	}
+	if !ok {
+		return false, false, nil
+	}
+	rehash = !m.current.Identify(encoded) || m.current.NeedsRehash(encoded)
+	return true, rehash, nil
+}
+
+// ParseHasher builds a Hasher from a spec such as "argon2id:m=65536,t=3,p=4",
+// "bcrypt:cost=12" or "scrypt:ln=15,r=8,p=1". Omitted parameters keep their
+// defaults.
+func ParseHasher(spec string) (Hasher, error) {
+	name, params, _ := strings.Cut(spec, ":")
+	kv, err := parseParams(params)
+	if err != nil {
+		return nil, err
+	}
+	switch name {
+	case "argon2id":
+		h := DefaultArgon2id
+		err = setParams(kv, map[string]func(int) error{
+			"m": func(v int) error { h.Memory = uint32(v); return inRange(v, 1, argon2MaxMemory) },
+			"t": func(v int) error { h.Time = uint32(v); return inRange(v, 1, argon2MaxTime) },
+			"p": func(v int) error { h.Threads = uint8(v); return inRange(v, 1, argon2MaxThreads) },
+		})
+		return h, err
+	case "bcrypt":
+		h := DefaultBcrypt
+		err = setParams(kv, map[string]func(int) error{
+			"cost": func(v int) error { h.Cost = v; return inRange(v, bcrypt.MinCost, bcrypt.MaxCost) },
+		})
+		return h, err
+	case "scrypt":
+		h := DefaultScrypt
+		err = setParams(kv, map[string]func(int) error{
+			"ln": func(v int) error { h.LogN = uint8(v); return inRange(v, 1, scryptMaxLogN) },
+			"r":  func(v int) error { h.R = v; return inRange(v, 1, scryptMaxR) },
+			"p":  func(v int) error { h.P = v; return inRange(v, 1, scryptMaxP) },
+		})
+		return h, err
+	}
+	return nil, fmt.Errorf("password: unknown hasher %q", name)
+}
+
+func inRange(v, lo, hi int) error {
+	if v < lo || v > hi {
+		return fmt.Errorf("password: %d not in [%d, %d]", v, lo, hi)
+	}
+	return nil
+}
+
+func setParams(kv map[string]string, setters map[string]func(int) error) error {
+	for k, v := range kv {
+		set, ok := setters[k]
+		if !ok {
+			return fmt.Errorf("password: unknown parameter %q", k)
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 1<<24 {
+			return fmt.Errorf("password: invalid value for %s: %q", k, v)
+		}
+		if err := set(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseParams parses "k=v,k2=v2".
+func parseParams(s string) (map[string]string, error) {
+	kv := map[string]string{}
+	if s == "" {
+		return kv, nil
+	}
+	for _, p := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(p, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("password: malformed parameter %q", p)
+		}
+		kv[k] = v
+	}
+	return kv, nil
+}
+
+func randomSalt(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func equal(a, b []byte) bool {
+	return subtle.ConstantTimeCompare(a, b) == 1
+}
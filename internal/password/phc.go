@@ -0,0 +1,72 @@
+package password
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+)
+
+// phc is a hash in PHC string format: $id[$v=version][$params]$salt$hash,
+// with salt and hash in unpadded standard base64.
+type phc struct {
+	id      string
+	version string
+	params  map[string]string
+	salt    []byte
+	hash    []byte
+}
+
+func decodePHC(encoded string) (*phc, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) < 4 || parts[0] != "" {
+		return nil, ErrMalformedHash
+	}
+	p := &phc{id: parts[1]}
+	rest := parts[2:]
+	if strings.HasPrefix(rest[0], "v=") {
+		p.version = strings.TrimPrefix(rest[0], "v=")
+		rest = rest[1:]
+	}
+	if len(rest) != 3 {
+		return nil, ErrMalformedHash
+	}
+	var err error
+	if p.params, err = parseParams(rest[0]); err != nil {
+		return nil, ErrMalformedHash
+	}
+	if p.salt, err = base64.RawStdEncoding.DecodeString(rest[1]); err != nil {
+		return nil, ErrMalformedHash
+	}
+	if p.hash, err = base64.RawStdEncoding.DecodeString(rest[2]); err != nil || len(p.hash) == 0 {
+		return nil, ErrMalformedHash
+	}
+	return p, nil
+}
+
+// encode writes params in the given order.
+func (p *phc) encode(order ...string) string {
+	var b strings.Builder
+	b.WriteString("$" + p.id)
+	if p.version != "" {
+		b.WriteString("$v=" + p.version)
+	}
+	b.WriteString("$")
+	for i, k := range order {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(k + "=" + p.params[k])
+	}
+	b.WriteString("$" + base64.RawStdEncoding.EncodeToString(p.salt))
+	b.WriteString("$" + base64.RawStdEncoding.EncodeToString(p.hash))
+	return b.String()
+}
+
+// uint reads a positive integer parameter no larger than max.
+func (p *phc) uint(name string, max uint64) (uint64, error) {
+	n, err := strconv.ParseUint(p.params[name], 10, 64)
+	if err != nil || n == 0 || n > max {
+		return 0, ErrMalformedHash
+	}
+	return n, nil
+}
@@ -0,0 +1,216 @@
+package password
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Rule names reported in Violation.Rule.
+const (
+	RuleMinLength        = "min_length"
+	RuleMaxLength        = "max_length"
+	RuleCharacterClasses = "character_classes"
+	RuleContainsUsername = "contains_username"
+	RuleCommonPassword   = "common_password"
+	RuleTooGuessable     = "too_guessable"
+)
+
+// Violation is one failed policy rule.
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Dictionary maps lowercase words to their frequency rank (1 = most common).
+type Dictionary map[string]int
+
+//go:embed common_passwords.txt
+var commonPasswordsTxt string
+
+// CommonPasswords is the built-in list of the most used passwords.
+var CommonPasswords = mustLoadDictionary(commonPasswordsTxt)
+
+// LoadDictionary reads one word per line, most common first. Blank lines and
+// lines starting with "#" are skipped.
+func LoadDictionary(r io.Reader) (Dictionary, error) {
+	d := Dictionary{}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		w := strings.ToLower(strings.TrimSpace(sc.Text()))
+		if w == "" || strings.HasPrefix(w, "#") {
+			continue
+		}
+		if _, ok := d[w]; !ok {
+			d[w] = len(d) + 1
+		}
+	}
+	return d, sc.Err()
+}
+
+func mustLoadDictionary(s string) Dictionary {
+	d, err := LoadDictionary(strings.NewReader(s))
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// MaxPasswordLength caps every policy's MaxLength. Unauthenticated requests
+// reach the strength estimate, whose cost grows with the cube of the length.
+const MaxPasswordLength = 256
+
+// Policy decides which passwords are acceptable. Lengths count characters
+// after normalization.
+type Policy struct {
+	MinLength int
+	// MaxLength bounds hashing cost; zero, like anything above it, means
+	// MaxPasswordLength.
+	MaxLength int
+	// Normalize applies Unicode NFKC before checking and hashing, so the same
+	// password typed on different devices hashes the same.
+	Normalize bool
+	// RequiredClasses is how many of lowercase, uppercase, digits and symbols
+	// must appear.
+	RequiredClasses int
+	// RejectUsername refuses passwords containing the username.
+	RejectUsername bool
+	// Common lists passwords that are refused outright; also used for the
+	// strength estimate. Nil disables both uses.
+	Common Dictionary
+	// MinScore is the lowest acceptable strength score (0-4, see Score).
+	MinScore int
+}
+
+// DefaultPolicy follows NIST SP 800-63B: length and blocklist checks, no
+// composition rules.
+var DefaultPolicy = Policy{
+	MinLength:      8,
+	MaxLength:      128,
+	Normalize:      true,
+	RejectUsername: true,
+	Common:         CommonPasswords,
+	MinScore:       2,
+}
+
+// maxLength returns the effective MaxLength.
+func (p Policy) maxLength() int {
+	if p.MaxLength <= 0 || p.MaxLength > MaxPasswordLength {
+		return MaxPasswordLength
+	}
+	return p.MaxLength
+}
+
+// normalize returns password as it is checked and hashed.
+func (p Policy) normalize(password string) string {
+	if p.Normalize {
+		return norm.NFKC.String(password)
+	}
+	return password
+}
+
+// Check returns every rule password breaks for username; none means it is acceptable.
+func (p Policy) Check(password, username string) []Violation {
+	password = p.normalize(password)
+	var out []Violation
+	n := utf8.RuneCountInString(password)
+	if n < p.MinLength {
+		out = append(out, Violation{RuleMinLength, fmt.Sprintf("must be at least %d characters", p.MinLength)})
+	}
+	if limit := p.maxLength(); n > limit {
+		// longer inputs are not analysed further
+		return append(out, Violation{RuleMaxLength, fmt.Sprintf("must be at most %d characters", limit)})
+	}
+	if p.RequiredClasses > 0 && characterClasses(password) < p.RequiredClasses {
+		out = append(out, Violation{RuleCharacterClasses,
+			fmt.Sprintf("must contain at least %d of: lowercase letters, uppercase letters, digits, symbols", p.RequiredClasses)})
+	}
+
+	lower := strings.ToLower(password)
+	user := strings.ToLower(p.normalize(strings.TrimSpace(username)))
+	if p.RejectUsername && utf8.RuneCountInString(user) >= 3 && strings.Contains(lower, user) {
+		out = append(out, Violation{RuleContainsUsername, "must not contain the username"})
+	}
+	if _, ok := p.Common[lower]; ok {
+		out = append(out, Violation{RuleCommonPassword, "is too common"})
+	} else if p.MinScore > 0 {
+		var inputs []string
+		if user != "" {
+			inputs = append(inputs, user)
+		}
+		if s := Score(EstimateGuesses(password, p.Common, inputs...)); s < p.MinScore {
+			out = append(out, Violation{RuleTooGuessable,
+				fmt.Sprintf("is too easy to guess (strength %d of 4, need %d)", s, p.MinScore)})
+		}
+	}
+	return out
+}
+
+func characterClasses(s string) int {
+	var lower, upper, digit, other bool
+	for _, r := range s {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+	n := 0
+	for _, b := range []bool{lower, upper, digit, other} {
+		if b {
+			n++
+		}
+	}
+	return n
+}
+
+// ParsePolicy builds a Policy from DefaultPolicy and a spec such as
+// "min=12,max=64,classes=3,score=3,username=1,normalize=1".
+func ParsePolicy(spec string) (Policy, error) {
+	p := DefaultPolicy
+	kv, err := parseParams(spec)
+	if err != nil {
+		return p, err
+	}
+	for k, v := range kv {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return p, fmt.Errorf("password: invalid value for %s: %q", k, v)
+		}
+		switch k {
+		case "min":
+			p.MinLength = n
+		case "max":
+			p.MaxLength = n
+		case "classes":
+			p.RequiredClasses = n
+		case "score":
+			p.MinScore = n
+		case "username":
+			p.RejectUsername = n != 0
+		case "normalize":
+			p.Normalize = n != 0
+		default:
+			return p, fmt.Errorf("password: unknown policy parameter %q", k)
+		}
+	}
+	if p.MaxLength > MaxPasswordLength {
+		return p, fmt.Errorf("password: max length %d exceeds the limit of %d", p.MaxLength, MaxPasswordLength)
+	}
+	if limit := p.maxLength(); p.MinLength > limit {
+		return p, fmt.Errorf("password: min length %d exceeds max length %d", p.MinLength, limit)
+	}
+	return p, nil
+}
@@ -0,0 +1,96 @@
+package password
+
+import (
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Scrypt hashes with scrypt. N is 2^LogN.
+type Scrypt struct {
+	LogN    uint8
+	R       int
+	P       int
+	SaltLen int
+	KeyLen  int
+}
+
+// DefaultScrypt uses N=2^15, r=8, p=1.
+var DefaultScrypt = Scrypt{LogN: 15, R: 8, P: 1, SaltLen: 16, KeyLen: 32}
+
+// Upper bounds on scrypt parameters, enforced both when configuring a hasher
+// and when decoding a hash.
+const (
+	scryptMaxLogN = 24
+	scryptMaxR    = 64
+	scryptMaxP    = 64
+)
+
+func (h Scrypt) Identify(encoded string) bool {
+	return strings.HasPrefix(encoded, "$scrypt$")
+}
+
+func (h Scrypt) Hash(password string) (string, error) {
+	salt, err := randomSalt(h.SaltLen)
+	if err != nil {
+		return "", err
+	}
+	release := acquireHashSlot()
+	key, err := scrypt.Key([]byte(password), salt, 1<<h.LogN, h.R, h.P, h.KeyLen)
+	release()
+	if err != nil {
+		return "", err
+	}
+	p := &phc{
+		id: "scrypt",
+		params: map[string]string{
+			"ln": strconv.Itoa(int(h.LogN)),
+			"r":  strconv.Itoa(h.R),
+			"p":  strconv.Itoa(h.P),
+		},
+		salt: salt,
+		hash: key,
+	}
+	return p.encode("ln", "r", "p"), nil
+}
+
+func (h Scrypt) Verify(password, encoded string) (bool, error) {
+	p, params, err := h.decode(encoded)
+	if err != nil {
+		return false, err
+	}
+	release := acquireHashSlot()
+	key, err := scrypt.Key([]byte(password), p.salt, 1<<params.LogN, params.R, params.P, len(p.hash))
+	release()
+	if err != nil {
+		return false, ErrMalformedHash
+	}
+	return equal(key, p.hash), nil
+}
+
+func (h Scrypt) NeedsRehash(encoded string) bool {
+	p, params, err := h.decode(encoded)
+	if err != nil {
+		return true
+	}
+	return params.LogN != h.LogN || params.R != h.R || params.P != h.P ||
+		len(p.salt) < h.SaltLen || len(p.hash) != h.KeyLen
+}
+
+// decode parses encoded, returning the parameters it was made with.
+func (h Scrypt) decode(encoded string) (*phc, Scrypt, error) {
+	var params Scrypt
+	p, err := decodePHC(encoded)
+	if err != nil || p.id != "scrypt" {
+		return nil, params, ErrMalformedHash
+	}
+	ln, err1 := p.uint("ln", scryptMaxLogN)
+	r, err2 := p.uint("r", scryptMaxR)
+	par, err3 := p.uint("p", scryptMaxP)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return nil, params, ErrMalformedHash
+	}
+	params.LogN, params.R, params.P = uint8(ln), int(r), int(par)
+	return p, params, nil
+}
@@ -0,0 +1,275 @@
+package password
+
+import (
+	"math"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// EstimateGuesses estimates how many guesses an attacker needs to find
+// password, in the manner of zxcvbn: the password is split into the cheapest
+// sequence of recognisable patterns (dictionary words, user inputs such as the
+// username, l33t spellings, repeats, sequences, keyboard runs and years) with
+// anything left over brute-forced. The search takes roughly cubic time, so
+// only the first MaxPasswordLength characters are analysed and the rest is
+// counted as brute force.
+func EstimateGuesses(password string, dict Dictionary, userInputs ...string) float64 {
+	runes := []rune(password)
+	if len(runes) > MaxPasswordLength {
+		return EstimateGuesses(string(runes[:MaxPasswordLength]), dict, userInputs...) *
+			math.Pow(10, bruteforceLog(len(runes)-MaxPasswordLength))
+	}
+	n := len(runes)
+	if n == 0 {
+		return 1
+	}
+	matches := findMatches(runes, dict, userInputs)
+
+	// best[k][l] is the log10 of the fewest guesses for runes[:k] split into l segments
+	inf := math.Inf(1)
+	best := make([][]float64, n+1)
+	for k := range best {
+		best[k] = make([]float64, n+1)
+		for l := range best[k] {
+			best[k][l] = inf
+		}
+	}
+	best[0][0] = 0
+	for j := 1; j <= n; j++ {
+		for i := 0; i < j; i++ {
+			// brute force for runes[i:j], or the cheapest pattern covering it exactly
+			cost := bruteforceLog(j - i)
+			if g, ok := matches[[2]int{i, j}]; ok && g < cost {
+				cost = g
+			}
+			for l := 0; l < j; l++ {
+				if v := best[i][l] + cost; v < best[j][l+1] {
+					best[j][l+1] = v
+				}
+			}
+		}
+	}
+	// more segments mean more ways to order them
+	min := inf
+	for l := 1; l <= n; l++ {
+		if v := best[n][l] + logFactorial(l); v < min {
+			min = v
+		}
+	}
+	return math.Pow(10, min)
+}
+
+// Score maps a guess count to 0 (trivial) .. 4 (strong), using zxcvbn's bands.
+func Score(guesses float64) int {
+	switch {
+	case guesses < 1e3+5:
+		return 0
+	case guesses < 1e6+5:
+		return 1
+	case guesses < 1e8+5:
+		return 2
+	case guesses < 1e10+5:
+		return 3
+	}
+	return 4
+}
+
+// minMultiCharGuesses stops short matches from being cheaper than a guess or two.
+const minMultiCharGuesses = 50
+
+// findMatches returns, for each [start, end) span with a recognised pattern,
+// the log10 guesses of its cheapest match.
+func findMatches(runes []rune, dict Dictionary, userInputs []string) map[[2]int]float64 {
+	out := map[[2]int]float64{}
+	add := func(i, j int, guesses float64) {
+		if j-i > 1 && guesses < minMultiCharGuesses {
+			guesses = minMultiCharGuesses
+		}
+		g := math.Log10(guesses)
+		if old, ok := out[[2]int{i, j}]; !ok || g < old {
+			out[[2]int{i, j}] = g
+		}
+	}
+
+	inputs := map[string]bool{}
+	for _, u := range userInputs {
+		inputs[strings.ToLower(u)] = true
+	}
+	n := len(runes)
+	for i := 0; i < n; i++ {
+		for j := i + 3; j <= n; j++ {
+			dictionaryMatch(runes[i:j], dict, inputs, func(g float64) { add(i, j, g) })
+		}
+	}
+
+	// repeats: "aaaa"
+	for i := 0; i < n; {
+		j := i + 1
+		for j < n && runes[j] == runes[i] {
+			j++
+		}
+		if j-i >= 3 {
+			add(i, j, cardinality(runes[i])*float64(j-i))
+		}
+		i = j
+	}
+
+	// sequences: "abcd", "9876"
+	for i := 0; i+2 < n; {
+		d := runes[i+1] - runes[i]
+		j := i + 1
+		if d == 1 || d == -1 {
+			for j+1 < n && runes[j+1]-runes[j] == d {
+				j++
+			}
+		}
+		if j-i+1 >= 3 {
+			base := cardinality(runes[i])
+			if strings.ContainsRune("aAzZ019", runes[i]) {
+				base = 4
+			}
+			g := base * float64(j-i+1)
+			if d < 0 {
+				g *= 2
+			}
+			add(i, j+1, g)
+			i = j
+			continue
+		}
+		i++
+	}
+
+	// keyboard runs along a row: "qwerty", "asdf"
+	lower := []rune(strings.ToLower(string(runes)))
+	for _, row := range []string{"`1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", "zxcvbnm,./"} {
+		for _, r := range []string{row, reverse(row)} {
+			for i := 0; i < n; i++ {
+				j := i
+				for j < n {
+					k := strings.IndexRune(r, lower[j])
+					if k < 0 || (j > i && strings.IndexRune(r, lower[j-1])+1 != k) {
+						break
+					}
+					j++
+				}
+				if j-i >= 4 {
+					add(i, j, 20*float64(j-i))
+				}
+			}
+		}
+	}
+
+	// years: "1987", guessed outward from the current year
+	now := time.Now().Year()
+	for i := 0; i+4 <= n; i++ {
+		y := 0
+		for _, r := range runes[i : i+4] {
+			if r < '0' || r > '9' {
+				y = -1
+				break
+			}
+			y = y*10 + int(r-'0')
+		}
+		if y >= 1900 && y <= now+25 {
+			add(i, i+4, math.Max(math.Abs(float64(y-now)), 20))
+		}
+	}
+	return out
+}
+
+// dictionaryMatch reports guesses for word if it, its reversal or its l33t
+// decoding is a user input or dictionary entry.
+func dictionaryMatch(word []rune, dict Dictionary, inputs map[string]bool, report func(float64)) {
+	lower := strings.ToLower(string(word))
+	upper := uppercaseVariations(word)
+	try := func(w string, factor float64) {
+		if inputs[w] {
+			report(factor * upper)
+		} else if rank, ok := dict[w]; ok {
+			report(float64(rank) * factor * upper)
+		}
+	}
+	try(lower, 1)
+	try(reverse(lower), 2)
+	for _, sub := range []map[rune]rune{leetI, leetL} {
+		if decoded := unleet(lower, sub); decoded != lower {
+			try(decoded, 2)
+		}
+	}
+}
+
+var (
+	leetI = map[rune]rune{'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '9': 'g', '1': 'i', '!': 'i', '|': 'l', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z'}
+	leetL = map[rune]rune{'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '9': 'g', '1': 'l', '!': 'i', '|': 'l', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z'}
+)
+
+func unleet(s string, sub map[rune]rune) string {
+	return strings.Map(func(r rune) rune {
+		if c, ok := sub[r]; ok {
+			return c
+		}
+		return r
+	}, s)
+}
+
+// uppercaseVariations is how many capitalisations an attacker tries before
+// reaching word's: 1 for lowercase, 2 for common shapes, otherwise the
+// number of ways to place its capitals.
+func uppercaseVariations(word []rune) float64 {
+	var upper, lower int
+	for _, r := range word {
+		if unicode.IsUpper(r) {
+			upper++
+		} else if unicode.IsLower(r) {
+			lower++
+		}
+	}
+	if upper == 0 {
+		return 1
+	}
+	if lower == 0 || (upper == 1 && (unicode.IsUpper(word[0]) || unicode.IsUpper(word[len(word)-1]))) {
+		return 2
+	}
+	var v float64
+	for k := 1; k <= upper && k <= lower; k++ {
+		v += binomial(upper+lower, k)
+	}
+	return v
+}
+
+func cardinality(r rune) float64 {
+	switch {
+	case r >= '0' && r <= '9':
+		return 10
+	case unicode.IsLetter(r):
+		return 26
+	}
+	return 33
+}
+
+func bruteforceLog(n int) float64 {
+	// ten guesses per character, as in zxcvbn
+	return float64(n)
+}
+
+func logFactorial(n int) float64 {
+	v, _ := math.Lgamma(float64(n + 1))
+	return v / math.Ln10
+}
+
+func binomial(n, k int) float64 {
+	v := 1.0
+	for i := 1; i <= k; i++ {
+		v = v * float64(n-k+i) / float64(i)
+	}
+	return v
+}
+
+func reverse(s string) string {
+	r := []rune(s)
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return string(r)
+}
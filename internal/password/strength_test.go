@@ -0,0 +1,38 @@
+package password
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPolicyCapsLength(t *testing.T) {
+	p, err := ParsePolicy("max=0,score=2")
+	if err != nil {
+		t.Fatalf("ParsePolicy: %v", err)
+	}
+	long := strings.Repeat("Zq8-vLm#2rTx", 10000)
+	start := time.Now()
+	violations := p.Check(long, "")
+	if len(violations) != 1 || violations[0].Rule != RuleMaxLength {
+		t.Errorf("Check() = %v, want only %s", violations, RuleMaxLength)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Check() took %s on a %d-character password", d, len(long))
+	}
+	if _, err := ParsePolicy("max=" + strconv.Itoa(MaxPasswordLength+1)); err == nil {
+		t.Errorf("ParsePolicy accepted a max above %d", MaxPasswordLength)
+	}
+}
+
+func TestEstimateGuessesYearsAroundNow(t *testing.T) {
+	// years are recognised up to 25 years ahead of the current one and cost
+	// their distance from it, so the edges of that range cost the same
+	year := time.Now().Year()
+	ahead := EstimateGuesses("kestrel"+strconv.Itoa(year+25), nil)
+	back := EstimateGuesses("kestrel"+strconv.Itoa(year-25), nil)
+	if ahead != back {
+		t.Errorf("guesses with %d = %.0f, with %d = %.0f, want them equal", year+25, ahead, year-25, back)
+	}
+}
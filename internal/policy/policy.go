@@ -0,0 +1,43 @@
+package policy
+
+import "time"
+
+// Policy bundles the lifetime rules the login and refresh handlers apply.
+type Policy struct {
+	Tokens   Tokens
+	Sessions Sessions
+}
+
+// Default keeps the service's original 15-minute access tokens and 24-hour
+// refresh tokens. It adds a 30-day session limit that did not exist before,
+// which also ends older sessions once they are 30 days past login.
+func Default() Policy {
+	return Policy{
+		Tokens: Tokens{
+			Default:              Lifetimes{AccessTTL: 15 * time.Minute, RefreshTTL: 24 * time.Hour},
+			RememberMeRefreshTTL: 30 * 24 * time.Hour,
+		},
+		Sessions: Sessions{
+			Default: Session{MaxAge: 30 * 24 * time.Hour},
+		},
+	}
+}
+
+// KnownClientType reports whether clientType is the default or has a session
+// or token override configured.
+func (p Policy) KnownClientType(clientType string) bool {
+	if _, ok := p.Sessions.For(clientType); ok {
+		return true
+	}
+	_, ok := p.Tokens.ByClient[clientType]
+	return ok
+}
+
+// Session returns the session policy for clientType, falling back to the
+// default for types without their own.
+func (p Policy) Session(clientType string) Session {
+	if s, ok := p.Sessions.For(clientType); ok {
+		return s
+	}
+	return p.Sessions.Default
+}
@@ -0,0 +1,113 @@
+// Package policy holds the lifetime rules applied when issuing tokens.
+package policy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultClientType is used when a login does not name a client type.
+const DefaultClientType = "default"
+
+// Session limits how long a refresh token family may be kept alive.
+type Session struct {
+	// MaxAge is the absolute session lifetime, measured from login and carried
+	// across rotations. Zero means unlimited.
+	MaxAge time.Duration
+	// IdleTimeout ends the session if it is not refreshed for this long. Zero
+	// leaves only the refresh token TTL in place.
+	IdleTimeout time.Duration
+}
+
+// ExpiresAt returns when a session started at started ends, or the zero time
+// if it has no absolute limit.
+func (s Session) ExpiresAt(started time.Time) time.Time {
+	if s.MaxAge <= 0 {
+		return time.Time{}
+	}
+	return started.Add(s.MaxAge)
+}
+
+// Expired reports whether a session started at started, last refreshed at
+// lastUsed, has outlived either limit at now.
+func (s Session) Expired(started, lastUsed, now time.Time) bool {
+	if end := s.ExpiresAt(started); !end.IsZero() && !now.Before(end) {
+		return true
+	}
+	return s.IdleTimeout > 0 && !now.Before(lastUsed.Add(s.IdleTimeout))
+}
+
+// RefreshExpiry caps a refresh token issued at now with the given ttl so it
+// outlives neither the idle timeout nor the session.
+func (s Session) RefreshExpiry(started, now time.Time, ttl time.Duration) time.Time {
+	exp := now.Add(ttl)
+	if s.IdleTimeout > 0 && now.Add(s.IdleTimeout).Before(exp) {
+		exp = now.Add(s.IdleTimeout)
+	}
+	if end := s.ExpiresAt(started); !end.IsZero() && end.Before(exp) {
+		exp = end
+	}
+	return exp
+}
+
+// Sessions maps client types (e.g. "web", "mobile") to their session policy.
+type Sessions struct {
+	Default  Session
+	ByClient map[string]Session
+}
+
+// For returns the policy for clientType; ok is false for unknown types. The
+// empty string and DefaultClientType select Default.
+func (p Sessions) For(clientType string) (s Session, ok bool) {
+	if clientType == "" || clientType == DefaultClientType {
+		return p.Default, true
+	}
+	s, ok = p.ByClient[clientType]
+	return s, ok
+}
+
+// ParseSessions parses per-client overrides of the form
+// "mobile=2160h/720h,cli=12h/1h" (max age / idle timeout; "0" disables a limit).
+func ParseSessions(v string, def Session) (Sessions, error) {
+	p := Sessions{Default: def, ByClient: map[string]Session{}}
+	pairs, err := parseDurationPairs(v)
+	if err != nil {
+		return p, err
+	}
+	for name, d := range pairs {
+		s := Session{MaxAge: d[0], IdleTimeout: d[1]}
+		if name == DefaultClientType {
+			p.Default = s
+		} else {
+			p.ByClient[name] = s
+		}
+	}
+	return p, nil
+}
+
+// parseDurationPairs parses "name=d1/d2,..." into name -> {d1, d2}.
+func parseDurationPairs(v string) (map[string][2]time.Duration, error) {
+	out := map[string][2]time.Duration{}
+	for _, entry := range strings.Split(v, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, pair, ok := strings.Cut(entry, "=")
+		first, second, ok2 := strings.Cut(pair, "/")
+		if !ok || !ok2 || name == "" {
+			return nil, fmt.Errorf("malformed entry %q", entry)
+		}
+		var d [2]time.Duration
+		var err error
+		if d[0], err = time.ParseDuration(first); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if d[1], err = time.ParseDuration(second); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		out[name] = d
+	}
+	return out, nil
+}
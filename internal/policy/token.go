@@ -0,0 +1,91 @@
+package policy
+
+import "time"
+
+// Lifetimes are the TTLs of the tokens issued together at login or refresh.
+// In overrides a zero field inherits the value it would otherwise have.
+type Lifetimes struct {
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+// Tokens decides token lifetimes. Overrides apply in order: client type,
+// then remember me (refresh TTL only), then roles. When several of a user's
+// roles override the same field, the shortest value wins.
+type Tokens struct {
+	Default  Lifetimes
+	ByClient map[string]Lifetimes
+	ByRole   map[string]Lifetimes
+	// RememberMeRefreshTTL replaces the refresh TTL for sessions started with
+	// "remember me"; zero ignores the flag.
+	RememberMeRefreshTTL time.Duration
+}
+
+// Resolve returns the lifetimes for a token issued to a session of clientType
+// for a user holding roles.
+func (p Tokens) Resolve(clientType string, roles []string, rememberMe bool) Lifetimes {
+	lt := p.Default
+	if o, ok := p.ByClient[clientType]; ok {
+		lt = lt.merge(o)
+	}
+	if rememberMe && p.RememberMeRefreshTTL > 0 {
+		lt.RefreshTTL = p.RememberMeRefreshTTL
+	}
+
+	var byRole Lifetimes
+	for _, r := range roles {
+		o, ok := p.ByRole[r]
+		if !ok {
+			continue
+		}
+		byRole.AccessTTL = shortest(byRole.AccessTTL, o.AccessTTL)
+		byRole.RefreshTTL = shortest(byRole.RefreshTTL, o.RefreshTTL)
+	}
+	return lt.merge(byRole)
+}
+
+// MaxAccessTTL returns the longest access token lifetime any override can
+// grant, which bounds how long an already issued access token stays valid.
+func (p Tokens) MaxAccessTTL() time.Duration {
+	ttl := p.Default.AccessTTL
+	for _, overrides := range []map[string]Lifetimes{p.ByClient, p.ByRole} {
+		for _, o := range overrides {
+			if o.AccessTTL > ttl {
+				ttl = o.AccessTTL
+			}
+		}
+	}
+	return ttl
+}
+
+// ParseLifetimes parses overrides of the form "admin=5m/0,cli=1h/12h"
+// (access TTL / refresh TTL; "0" inherits).
+func ParseLifetimes(v string) (map[string]Lifetimes, error) {
+	pairs, err := parseDurationPairs(v)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]Lifetimes, len(pairs))
+	for name, d := range pairs {
+		out[name] = Lifetimes{AccessTTL: d[0], RefreshTTL: d[1]}
+	}
+	return out, nil
+}
+
+func (l Lifetimes) merge(o Lifetimes) Lifetimes {
+	if o.AccessTTL > 0 {
+		l.AccessTTL = o.AccessTTL
+	}
+	if o.RefreshTTL > 0 {
+		l.RefreshTTL = o.RefreshTTL
+	}
+	return l
+}
+
+// shortest returns the smaller positive duration, treating zero as unset.
+func shortest(a, b time.Duration) time.Duration {
+	if a <= 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
+}
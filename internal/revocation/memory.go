@@ -0,0 +1,86 @@
+package revocation
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-process Store. Entries are lost on restart, so it
+// suits single-instance deployments and tests.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	tokens   map[string]time.Time
+	sessions map[string]time.Time
+	cutoffs  map[int64]time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		tokens:   make(map[string]time.Time),
+		sessions: make(map[string]time.Time),
+		cutoffs:  make(map[int64]time.Time),
+	}
+}
+
+func (m *MemoryStore) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokens[jti] = expiresAt
+	return nil
+}
+
+func (m *MemoryStore) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.tokens[jti]
+	return ok, nil
+}
+
+func (m *MemoryStore) RevokeSession(ctx context.Context, sid string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if expiresAt.After(m.sessions[sid]) {
+		m.sessions[sid] = expiresAt
+	}
+	return nil
+}
+
+func (m *MemoryStore) IsSessionRevoked(ctx context.Context, sid string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.sessions[sid]
+	return ok, nil
+}
+
+func (m *MemoryStore) SetUserCutoff(ctx context.Context, userID int64, cutoff time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cutoffs[userID] = cutoff
+	return nil
+}
+
+func (m *MemoryStore) UserCutoff(ctx context.Context, userID int64) (time.Time, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.cutoffs[userID], nil
+}
+
+func (m *MemoryStore) Prune(ctx context.Context, now time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for jti, exp := range m.tokens {
+		if !exp.After(now) {
+			delete(m.tokens, jti)
+			n++
+		}
+	}
+	for sid, exp := range m.sessions {
+		if !exp.After(now) {
+			delete(m.sessions, sid)
+			n++
+		}
+	}
+	return n, nil
+}
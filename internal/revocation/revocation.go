@@ -0,0 +1,49 @@
+// Package revocation tracks access tokens that must be rejected before their
+// natural expiry: individual tokens by jti, every token of a session by sid,
+// and per-user cutoffs that invalidate everything issued before a point in time.
+package revocation
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Store persists revoked token IDs and per-user cutoffs.
+type Store interface {
+	// RevokeToken denylists jti until expiresAt, after which the token is
+	// rejected on expiry alone and the entry may be pruned.
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	// IsTokenRevoked reports whether jti has been denylisted.
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+	// RevokeSession denylists every token carrying sid until expiresAt, by
+	// which all of them have expired.
+	RevokeSession(ctx context.Context, sid string, expiresAt time.Time) error
+	// IsSessionRevoked reports whether sid has been denylisted.
+	IsSessionRevoked(ctx context.Context, sid string) (bool, error)
+	// SetUserCutoff invalidates every token of userID issued before cutoff.
+	SetUserCutoff(ctx context.Context, userID int64, cutoff time.Time) error
+	// UserCutoff returns the user's cutoff, or the zero time if none is set.
+	UserCutoff(ctx context.Context, userID int64) (time.Time, error)
+	// Prune drops denylist entries whose tokens have expired by now and
+	// returns how many were removed.
+	Prune(ctx context.Context, now time.Time) (int64, error)
+}
+
+// StartPruner calls s.Prune every interval until ctx is cancelled.
+func StartPruner(ctx context.Context, s Store, interval time.Duration) {
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-t.C:
+				if _, err := s.Prune(ctx, now); err != nil {
+					log.Printf("revocation prune: %v", err)
+				}
+			}
+		}
+	}()
+}
@@ -1,26 +1,142 @@
 package server
 
 import (
+	"expvar"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/prfc0/authN/internal/handlers"
+	"github.com/prfc0/authN/internal/mail"
 	"github.com/prfc0/authN/internal/middleware"
+	"github.com/prfc0/authN/internal/notify"
+	"github.com/prfc0/authN/internal/password"
+	"github.com/prfc0/authN/internal/policy"
 	"github.com/prfc0/authN/internal/store"
 	"github.com/prfc0/authN/internal/token"
+	"github.com/prfc0/authN/internal/username"
 )
 
 type Server struct {
 	srv *http.Server
 }
 
-func New(us store.UserStore, tm *token.TokenManager) *Server {
+// Config holds deployment settings that the handlers need.
+type Config struct {
+	// Issuer is the externally visible base URL of this service, advertised
+	// in the discovery document.
+	Issuer string
+	// IntrospectionClients maps client ID to secret for HTTP Basic
+	// authentication on the introspection endpoint.
+	IntrospectionClients map[string]string
+	// BackendAudience is the audience the demo backend accepts tokens for.
+	BackendAudience string
+	// SelfAudience is the audience the account, session and logout-all
+	// routes require, so tokens minted for other services cannot manage the
+	// user's account. Empty accepts any audience, which only suits
+	// deployments that issue tokens without one.
+	SelfAudience string
+	// RefreshGracePeriod is how long after a rotation the old refresh token
+	// may be presented again to receive the same successor.
+	RefreshGracePeriod time.Duration
+	// Policy sets token lifetimes and session limits.
+	Policy policy.Policy
+	// DebugVars exposes expvar metrics (e.g. refresh tokens purged) at
+	// /debug/vars. Leave off unless the endpoint is firewalled.
+	DebugVars bool
+	// Passwords hashes and verifies passwords; nil uses argon2id defaults.
+	Passwords *password.Manager
+	// Usernames decides which usernames may be registered; nil uses
+	// username.DefaultRules.
+	Usernames *username.Rules
+	// Mailer sends verification emails; nil logs them instead.
+	Mailer mail.Mailer
+	// EmailVerificationURL is where verification links point; empty uses this
+	// service's verify-email endpoint under Issuer.
+	EmailVerificationURL string
+	// EmailVerificationTTL is how long a verification link stays valid;
+	// zero means 24h.
+	EmailVerificationTTL time.Duration
+	// RequireVerifiedEmail makes an email mandatory at registration and
+	// refuses login until it is verified.
+	RequireVerifiedEmail bool
+	// Notifier delivers password reset links and notices; nil emails them
+	// through Mailer to verified addresses.
+	Notifier notify.Notifier
+	// PasswordResetURL is the page where users choose a new password. This
+	// service has no such page, so password reset is only served when it is
+	// set.
+	PasswordResetURL string
+	// PasswordResetTTL is how long a reset link stays valid; zero means 30m.
+	PasswordResetTTL time.Duration
+	// AccountRestoreWindow keeps deleted accounts restorable for this long
+	// before they are purged; zero deletes them at once.
+	AccountRestoreWindow time.Duration
+}
+
+func New(us store.UserStore, tm *token.TokenManager, cfg Config) *Server {
+	if cfg.Passwords == nil {
+		cfg.Passwords = password.NewManager(password.DefaultArgon2id)
+	}
+	if cfg.Usernames == nil {
+		cfg.Usernames = &username.DefaultRules
+	}
+	ev := handlers.EmailVerification{
+		Mailer:   cfg.Mailer,
+		LinkURL:  cfg.EmailVerificationURL,
+		TTL:      cfg.EmailVerificationTTL,
+		Required: cfg.RequireVerifiedEmail,
+	}
+	if ev.Mailer == nil {
+		ev.Mailer = mail.LogMailer{}
+	}
+	if ev.LinkURL == "" {
+		ev.LinkURL = strings.TrimRight(cfg.Issuer, "/") + "/api/v1/auth/verify-email"
+	}
+	if ev.TTL <= 0 {
+		ev.TTL = 24 * time.Hour
+	}
+	pr := handlers.PasswordReset{
+		Notifier: cfg.Notifier,
+		LinkURL:  cfg.PasswordResetURL,
+		TTL:      cfg.PasswordResetTTL,
+	}
+	if pr.Notifier == nil {
+		pr.Notifier = notify.EmailNotifier{Mailer: ev.Mailer}
+	}
+	if pr.TTL <= 0 {
+		pr.TTL = 30 * time.Minute
+	}
 	mux := http.NewServeMux()
-	mux.Handle("/api/v1/auth/register", handlers.MakeRegisterHandler(us))
-	mux.Handle("/api/v1/auth/login", handlers.MakeLoginHandler(us, tm))
-	mux.Handle("/api/v1/auth/refresh", handlers.MakeRefreshHandler(us, tm))
-	mux.Handle("/api/v1/backend", middleware.RequireAuth(tm)(handlers.MakeBackendHandler()))
+	mux.Handle("/.well-known/jwks.json", handlers.MakeJWKSHandler(tm))
+	mux.Handle("/.well-known/openid-configuration", handlers.MakeDiscoveryHandler(cfg.Issuer, tm))
+	mux.Handle("/api/v1/auth/register", handlers.MakeRegisterHandler(us, tm, cfg.Passwords, *cfg.Usernames, ev))
+	mux.Handle("/api/v1/auth/login", handlers.MakeLoginHandler(us, tm, cfg.Policy, cfg.Passwords, cfg.RequireVerifiedEmail))
+	mux.Handle("/api/v1/auth/refresh", handlers.MakeRefreshHandler(us, tm, cfg.Policy, cfg.RefreshGracePeriod))
+	mux.Handle("/api/v1/auth/introspect", middleware.RequireClientAuth(cfg.IntrospectionClients)(handlers.MakeIntrospectHandler(us, tm, cfg.Policy)))
+	mux.Handle("/api/v1/auth/revoke", handlers.MakeRevokeHandler(us, tm))
+	mux.Handle("/api/v1/auth/logout", handlers.MakeLogoutHandler(us, tm))
+	mux.Handle("/api/v1/auth/logout/all", middleware.RequireAuth(tm, cfg.SelfAudience)(handlers.MakeLogoutAllHandler(us, tm)))
+	mux.Handle("/api/v1/auth/verify-email", handlers.MakeVerifyEmailHandler(us, tm))
+	mux.Handle("/api/v1/auth/verify-email/resend", handlers.MakeResendVerificationHandler(us, tm, ev))
+	if pr.LinkURL != "" {
+		mux.Handle("/api/v1/auth/password/forgot", handlers.MakeForgotPasswordHandler(us, pr))
+		mux.Handle("/api/v1/auth/password/reset", handlers.MakeResetPasswordHandler(us, tm, cfg.Passwords, pr.Notifier))
+	}
+	mux.Handle("/api/v1/account", middleware.RequireAuth(tm, cfg.SelfAudience)(handlers.MakeDeleteAccountHandler(us, tm, cfg.Passwords, cfg.AccountRestoreWindow)))
+	mux.Handle("/api/v1/account/password", middleware.RequireAuth(tm, cfg.SelfAudience)(handlers.MakeChangePasswordHandler(us, tm, cfg.Passwords, cfg.Policy, pr.Notifier)))
+	if cfg.AccountRestoreWindow > 0 {
+		mux.Handle("/api/v1/account/restore", handlers.MakeRestoreAccountHandler(us, cfg.Passwords, cfg.AccountRestoreWindow))
+	}
+	mux.Handle("/api/v1/account/email", middleware.RequireAuth(tm, cfg.SelfAudience)(handlers.MakeChangeEmailHandler(us, tm, cfg.Passwords, ev)))
+	mux.Handle("/api/v1/sessions", middleware.RequireAuth(tm, cfg.SelfAudience)(handlers.MakeListSessionsHandler(us)))
+	mux.Handle("/api/v1/sessions/{id}", middleware.RequireAuth(tm, cfg.SelfAudience)(handlers.MakeRevokeSessionHandler(us, tm, cfg.Policy)))
+	mux.Handle("/api/v1/backend", middleware.RequireAuth(tm, cfg.BackendAudience)(handlers.MakeBackendHandler()))
+
+	if cfg.DebugVars {
+		mux.Handle("/debug/vars", expvar.Handler())
+	}
 
 	s := &http.Server{
 		Handler:      loggingMiddleware(mux),
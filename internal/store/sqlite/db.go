@@ -0,0 +1,32 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "modernc.org/sqlite"
+)
+
+// Open opens the SQLite database at path with the settings the stores rely on.
+func Open(path string) (*sql.DB, error) {
+	// immediate transactions take the write lock up front so concurrent
+	// writers wait on busy_timeout instead of failing on lock upgrade
+	return sql.Open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_txlock=immediate")
+}
+
+// Migrate creates or upgrades every table the stores use.
+func Migrate(db *sql.DB) error {
+	if err := EnsureUsersTable(db); err != nil {
+		return fmt.Errorf("users: %w", err)
+	}
+	if err := EnsureRefreshTokensTable(db); err != nil {
+		return fmt.Errorf("refresh_tokens: %w", err)
+	}
+	if err := EnsureOneTimeTokensTable(db); err != nil {
+		return fmt.Errorf("one_time_tokens: %w", err)
+	}
+	if err := EnsureRevocationTables(db); err != nil {
+		return fmt.Errorf("revocation: %w", err)
+	}
+	return nil
+}
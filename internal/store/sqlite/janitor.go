@@ -0,0 +1,112 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"expvar"
+	"log"
+	"time"
+)
+
+// DefaultTokenRetention is how long refresh token rows are kept after they expire.
+const DefaultTokenRetention = 7 * 24 * time.Hour
+
+const purgeBatchSize = 500
+
+// janitorStats is published under /debug/vars.
+var janitorStats = expvar.NewMap("refresh_token_janitor")
+
+// PurgeRefreshTokens deletes refresh token rows that expired more than
+// retention before now and returns how many were deleted. Rows of a family
+// that still has a live token are kept, however old: presenting any of them
+// must keep tripping reuse detection for that session.
+func PurgeRefreshTokens(ctx context.Context, db *sql.DB, now time.Time, retention time.Duration) (int64, error) {
+	cutoff := now.Add(-retention).UTC().Format(time.RFC3339Nano)
+	live := now.UTC().Format(time.RFC3339Nano)
+
+	// batches keep each write transaction, and so the lock, short
+	var total int64
+	for {
+		res, err := db.ExecContext(ctx, `DELETE FROM refresh_tokens WHERE id IN (
+	SELECT t.id FROM refresh_tokens t
+	WHERE julianday(t.expires_at) < julianday(?)
+	  AND (t.family_id IS NULL OR NOT EXISTS (
+		SELECT 1 FROM refresh_tokens l
+		WHERE l.family_id = t.family_id AND l.revoked = 0 AND julianday(l.expires_at) > julianday(?)))
+	LIMIT ?)`, cutoff, live, purgeBatchSize)
+		if err != nil {
+			return total, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+		if n < purgeBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// StartRefreshTokenJanitor runs PurgeRefreshTokens and PurgeOneTimeTokens
+// every interval until ctx is cancelled, recording runs, deleted rows and
+// errors in expvar.
+func StartRefreshTokenJanitor(ctx context.Context, db *sql.DB, interval, retention time.Duration) {
+	runJanitor(ctx, interval, "refresh token janitor", janitorStats, func(now time.Time) (int64, error) {
+		n, err := PurgeRefreshTokens(ctx, db, now, retention)
+		if err != nil {
+			return n, err
+		}
+		m, err := PurgeOneTimeTokens(ctx, db, now, retention)
+		return n + m, err
+	})
+}
+
+// deletedUserStats is published under /debug/vars.
+var deletedUserStats = expvar.NewMap("deleted_user_janitor")
+
+// PurgeDeletedUsers permanently removes users soft-deleted more than window
+// before now, along with their tokens, and returns how many were removed.
+func PurgeDeletedUsers(ctx context.Context, db *sql.DB, now time.Time, window time.Duration) (int64, error) {
+	res, err := db.ExecContext(ctx,
+		`DELETE FROM users WHERE deleted_at IS NOT NULL AND julianday(deleted_at) < julianday(?)`,
+		now.Add(-window).UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// StartDeletedUserJanitor runs PurgeDeletedUsers every interval until ctx is
+// cancelled, recording runs, deleted rows and errors in expvar.
+func StartDeletedUserJanitor(ctx context.Context, db *sql.DB, interval, window time.Duration) {
+	runJanitor(ctx, interval, "deleted user janitor", deletedUserStats, func(now time.Time) (int64, error) {
+		return PurgeDeletedUsers(ctx, db, now, window)
+	})
+}
+
+// runJanitor calls purge every interval until ctx is cancelled.
+func runJanitor(ctx context.Context, interval time.Duration, name string, stats *expvar.Map, purge func(now time.Time) (int64, error)) {
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-t.C:
+				n, err := purge(now)
+				stats.Add("runs", 1)
+				stats.Add("purged", n)
+				if err != nil {
+					stats.Add("errors", 1)
+					log.Printf("%s: %v", name, err)
+					continue
+				}
+				if n > 0 {
+					log.Printf("%s: purged %d rows", name, n)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,109 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/prfc0/authN/internal/model"
+)
+
+// EnsureOneTimeTokensTable creates the table recording issued action tokens.
+func EnsureOneTimeTokensTable(db *sql.DB) error {
+	schema := `
+CREATE TABLE IF NOT EXISTS one_time_tokens (
+	id TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	purpose TEXT NOT NULL,
+	email TEXT NULL,
+	created_at TEXT NOT NULL,
+	expires_at TEXT NOT NULL,
+	used_at TEXT NULL,
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_one_time_tokens_user ON one_time_tokens(user_id, purpose);
+`
+	_, err := db.Exec(schema)
+	return err
+}
+
+// CreateOneTimeToken marks the user's unused tokens for the same purpose as
+// used, so only the most recent link works, and records t.
+func (s *SQLiteUserStore) CreateOneTimeToken(ctx context.Context, t *model.OneTimeToken) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE one_time_tokens SET used_at = ? WHERE user_id = ? AND purpose = ? AND used_at IS NULL`,
+		now, t.UserID, t.Purpose); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO one_time_tokens (id, user_id, purpose, email, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		t.ID, t.UserID, t.Purpose, nullString(t.Email), now, t.ExpiresAt.UTC().Format(time.RFC3339Nano)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ConsumeOneTimeToken claims the token with a compare-and-swap on used_at, so
+// of concurrent attempts exactly one gets it.
+func (s *SQLiteUserStore) ConsumeOneTimeToken(ctx context.Context, id, purpose string) (*model.OneTimeToken, error) {
+	now := time.Now().UTC()
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE one_time_tokens SET used_at = ?
+		 WHERE id = ? AND purpose = ? AND used_at IS NULL AND julianday(expires_at) > julianday(?)`,
+		now.Format(time.RFC3339Nano), id, purpose, now.Format(time.RFC3339Nano))
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return nil, err
+	}
+	return s.getOneTimeToken(ctx, `WHERE id = ?`, id)
+}
+
+// GetOneTimeToken looks a token up without using it.
+func (s *SQLiteUserStore) GetOneTimeToken(ctx context.Context, id, purpose string) (*model.OneTimeToken, error) {
+	return s.getOneTimeToken(ctx, `WHERE id = ? AND purpose = ? AND used_at IS NULL AND julianday(expires_at) > julianday(?)`,
+		id, purpose, time.Now().UTC().Format(time.RFC3339Nano))
+}
+
+// getOneTimeToken returns the row matching where; (nil, nil) if there is none.
+func (s *SQLiteUserStore) getOneTimeToken(ctx context.Context, where string, args ...interface{}) (*model.OneTimeToken, error) {
+	var t model.OneTimeToken
+	var email, usedAt sql.NullString
+	var createdAt, expiresAt string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, user_id, purpose, email, created_at, expires_at, used_at FROM one_time_tokens `+where, args...).
+		Scan(&t.ID, &t.UserID, &t.Purpose, &email, &createdAt, &expiresAt, &usedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.Email = email.String
+	t.CreatedAt, _ = time.Parse(time.RFC3339Nano, createdAt)
+	t.ExpiresAt, _ = time.Parse(time.RFC3339Nano, expiresAt)
+	if u, err := time.Parse(time.RFC3339Nano, usedAt.String); err == nil {
+		t.UsedAt = &u
+	}
+	return &t, nil
+}
+
+// PurgeOneTimeTokens deletes tokens that expired more than retention before
+// now and returns how many were deleted.
+func PurgeOneTimeTokens(ctx context.Context, db *sql.DB, now time.Time, retention time.Duration) (int64, error) {
+	res, err := db.ExecContext(ctx, `DELETE FROM one_time_tokens WHERE julianday(expires_at) < julianday(?)`,
+		now.Add(-retention).UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,143 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/prfc0/authN/internal/revocation"
+)
+
+// SQLiteRevocationStore persists the access token denylist and per-user
+// cutoffs so revocations survive restarts and are shared between instances.
+type SQLiteRevocationStore struct {
+	db *sql.DB
+}
+
+func NewSQLiteRevocationStore(db *sql.DB) revocation.Store {
+	return &SQLiteRevocationStore{db: db}
+}
+
+func EnsureRevocationTables(db *sql.DB) error {
+	schema := `
+CREATE TABLE IF NOT EXISTS revoked_access_tokens (
+	jti TEXT PRIMARY KEY,
+	expires_at TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS revoked_sessions (
+	sid TEXT PRIMARY KEY,
+	expires_at TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS access_token_cutoffs (
+	user_id INTEGER PRIMARY KEY,
+	not_after TEXT NOT NULL
+);
+`
+	if _, err := db.Exec(schema); err != nil {
+		return err
+	}
+	return dropCutoffForeignKey(db)
+}
+
+// dropCutoffForeignKey rebuilds access_token_cutoffs without the foreign key
+// older databases created it with. A cutoff must outlive its user: deleting
+// the user would otherwise delete the cutoff and revive their access tokens.
+// User IDs are never reused, so a leftover cutoff affects no one else.
+func dropCutoffForeignKey(db *sql.DB) error {
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM pragma_foreign_key_list('access_token_cutoffs')`).Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		return nil
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, stmt := range []string{
+		`CREATE TABLE access_token_cutoffs_new (user_id INTEGER PRIMARY KEY, not_after TEXT NOT NULL)`,
+		`INSERT INTO access_token_cutoffs_new (user_id, not_after) SELECT user_id, not_after FROM access_token_cutoffs`,
+		`DROP TABLE access_token_cutoffs`,
+		`ALTER TABLE access_token_cutoffs_new RENAME TO access_token_cutoffs`,
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteRevocationStore) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO revoked_access_tokens (jti, expires_at) VALUES (?, ?) ON CONFLICT(jti) DO NOTHING`,
+		jti, expiresAt.UTC().Format(time.RFC3339Nano))
+	return err
+}
+
+func (s *SQLiteRevocationStore) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var one int
+	err := s.db.QueryRowContext(ctx, `SELECT 1 FROM revoked_access_tokens WHERE jti = ?`, jti).Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *SQLiteRevocationStore) RevokeSession(ctx context.Context, sid string, expiresAt time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO revoked_sessions (sid, expires_at) VALUES (?, ?)
+		 ON CONFLICT(sid) DO UPDATE SET expires_at = excluded.expires_at
+		 WHERE julianday(excluded.expires_at) > julianday(revoked_sessions.expires_at)`,
+		sid, expiresAt.UTC().Format(time.RFC3339Nano))
+	return err
+}
+
+func (s *SQLiteRevocationStore) IsSessionRevoked(ctx context.Context, sid string) (bool, error) {
+	var one int
+	err := s.db.QueryRowContext(ctx, `SELECT 1 FROM revoked_sessions WHERE sid = ?`, sid).Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *SQLiteRevocationStore) SetUserCutoff(ctx context.Context, userID int64, cutoff time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO access_token_cutoffs (user_id, not_after) VALUES (?, ?)
+		 ON CONFLICT(user_id) DO UPDATE SET not_after = excluded.not_after`,
+		userID, cutoff.UTC().Format(time.RFC3339Nano))
+	return err
+}
+
+func (s *SQLiteRevocationStore) UserCutoff(ctx context.Context, userID int64) (time.Time, error) {
+	var notAfter string
+	err := s.db.QueryRowContext(ctx, `SELECT not_after FROM access_token_cutoffs WHERE user_id = ?`, userID).Scan(&notAfter)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339Nano, notAfter)
+}
+
+func (s *SQLiteRevocationStore) Prune(ctx context.Context, now time.Time) (int64, error) {
+	var total int64
+	for _, table := range []string{"revoked_access_tokens", "revoked_sessions"} {
+		res, err := s.db.ExecContext(ctx,
+			`DELETE FROM `+table+` WHERE julianday(expires_at) <= julianday(?)`,
+			now.UTC().Format(time.RFC3339Nano))
+		if err != nil {
+			return total, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
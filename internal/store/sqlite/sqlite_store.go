@@ -4,10 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"log"
 	"time"
 
 	"github.com/prfc0/authN/internal/model"
 	"github.com/prfc0/authN/internal/store"
+	"github.com/prfc0/authN/internal/username"
 )
 
 type SQLiteUserStore struct {
@@ -27,8 +29,109 @@ CREATE TABLE IF NOT EXISTS users (
   created_at TEXT NOT NULL
 );
 `
-	_, err := db.Exec(schema)
-	return err
+	if _, err := db.Exec(schema); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "users", "disabled", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "users", "username_canonical", "TEXT NULL"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "users", "username_skeleton", "TEXT NULL"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "users", "email", "TEXT NULL"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "users", "email_verified", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "users", "pending_email", "TEXT NULL"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "users", "deleted_at", "TEXT NULL"); err != nil {
+		return err
+	}
+	if err := migrateUnverifiedEmails(db); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username_canonical ON users(username_canonical) WHERE username_canonical IS NOT NULL`); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username_skeleton ON users(username_skeleton) WHERE username_skeleton IS NOT NULL`); err != nil {
+		return err
+	}
+	return backfillUsernames(db)
+}
+
+// migrateUnverifiedEmails moves addresses nobody has verified out of email,
+// which databases created before pending_email existed used for them, and
+// makes only verified addresses unique. Otherwise anyone could claim an
+// address by registering with it and lock its owner out.
+func migrateUnverifiedEmails(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, stmt := range []string{
+		`DROP INDEX IF EXISTS idx_users_email`,
+		`UPDATE users SET pending_email = COALESCE(pending_email, email), email = NULL
+		 WHERE email IS NOT NULL AND email_verified = 0`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_users_verified_email ON users(email) WHERE email_verified = 1`,
+		`CREATE INDEX IF NOT EXISTS idx_users_pending_email ON users(pending_email) WHERE pending_email IS NOT NULL`,
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// backfillUsernames derives the lookup keys of users created before they were
+// stored. The oldest user wins a collision: a later one whose key is taken,
+// e.g. "Alice" next to "alice", keeps none and can only log in with the exact
+// username until renamed.
+func backfillUsernames(db *sql.DB) error {
+	rows, err := db.Query(`SELECT id, username FROM users WHERE username_canonical IS NULL ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	type user struct {
+		id   int64
+		name string
+	}
+	var users []user
+	for rows.Next() {
+		var u user
+		if err := rows.Scan(&u.id, &u.name); err != nil {
+			rows.Close()
+			return err
+		}
+		users = append(users, u)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, u := range users {
+		n := username.Canonicalize(u.name)
+		_, err := db.Exec(`UPDATE users SET username_canonical = ?, username_skeleton = ? WHERE id = ?`, n.Canonical, n.Skeleton, u.id)
+		if isUniqueConstraintErr(err) {
+			// a look-alike of another user still gets a lookup key
+			_, err = db.Exec(`UPDATE users SET username_canonical = ? WHERE id = ?`, n.Canonical, u.id)
+		}
+		if isUniqueConstraintErr(err) {
+			log.Printf("users: username %q of user %d collides with another user; left without canonical key", u.name, u.id)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func EnsureRefreshTokensTable(db *sql.DB) error {
@@ -45,14 +148,35 @@ CREATE TABLE IF NOT EXISTS refresh_tokens (
 	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
 );
 `
-	_, err := db.Exec(schema)
+	if _, err := db.Exec(schema); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "refresh_tokens", "family_id", "TEXT NULL"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "refresh_tokens", "client_type", "TEXT NULL"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "refresh_tokens", "session_started_at", "TEXT NULL"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "refresh_tokens", "remember_me", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "refresh_tokens", "user_agent", "TEXT NULL"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "refresh_tokens", "client_ip", "TEXT NULL"); err != nil {
+		return err
+	}
+	_, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens(family_id)`)
 	return err
 }
 
-func (s *SQLiteUserStore) CreateUser(ctx context.Context, username, passwordHash string) (int64, error) {
+func (s *SQLiteUserStore) CreateUser(ctx context.Context, name username.Name, email, passwordHash string) (int64, error) {
 	res, err := s.db.ExecContext(ctx,
-		`INSERT INTO users (username, password_hash, created_at) VALUES (?, ?, ?)`,
-		username, passwordHash, time.Now().UTC().Format(time.RFC3339Nano))
+		`INSERT INTO users (username, username_canonical, username_skeleton, pending_email, password_hash, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		name.Display, name.Canonical, name.Skeleton, nullString(email), passwordHash, time.Now().UTC().Format(time.RFC3339Nano))
 	if err != nil {
 		// map sqlite unique constraint to a sentinel error (caller can inspect)
 		if isUniqueConstraintErr(err) {
@@ -63,19 +187,119 @@ func (s *SQLiteUserStore) CreateUser(ctx context.Context, username, passwordHash
 	return res.LastInsertId()
 }
 
-func (s *SQLiteUserStore) GetUserByUsername(ctx context.Context, username string) (*model.User, error) {
-	row := s.db.QueryRowContext(ctx, `SELECT id, username, password_hash, created_at FROM users WHERE username = ?`, username)
+const userColumns = `id, username, password_hash, email, email_verified, pending_email, disabled, created_at, deleted_at`
+
+// GetUserByUsername matches the canonical form. Users left without one by
+// backfillUsernames match their exact username, and take precedence so they
+// are not shadowed by the user they collided with.
+func (s *SQLiteUserStore) GetUserByUsername(ctx context.Context, name username.Name) (*model.User, error) {
+	return scanUser(s.db.QueryRowContext(ctx,
+		`SELECT `+userColumns+` FROM users WHERE username_canonical = ? OR (username_canonical IS NULL AND username = ?)
+		 ORDER BY username_canonical IS NULL DESC LIMIT 1`,
+		name.Canonical, name.Display))
+}
+
+// UpdatePasswordHash replaces the stored hash, e.g. after a rehash on login.
+func (s *SQLiteUserStore) UpdatePasswordHash(ctx context.Context, userID int64, passwordHash string) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE users SET password_hash = ? WHERE id = ?`, passwordHash, userID)
+	return err
+}
+
+// DeleteUser relies on ON DELETE CASCADE to remove the user's refresh and
+// one-time tokens.
+func (s *SQLiteUserStore) DeleteUser(ctx context.Context, userID int64) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM users WHERE id = ?`, userID)
+	return err
+}
+
+func (s *SQLiteUserStore) SoftDeleteUser(ctx context.Context, userID int64, at time.Time) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE users SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL`,
+		at.UTC().Format(time.RFC3339Nano), userID)
+	return err
+}
+
+func (s *SQLiteUserStore) RestoreUser(ctx context.Context, userID int64, since time.Time) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE users SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL AND julianday(deleted_at) >= julianday(?)`,
+		userID, since.UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *SQLiteUserStore) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	return scanUser(s.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE email = ? AND email_verified = 1`, email))
+}
+
+func (s *SQLiteUserStore) ListUsersByPendingEmail(ctx context.Context, email string, limit int) ([]*model.User, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+userColumns+` FROM users WHERE pending_email = ? ORDER BY id DESC LIMIT ?`, email, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var users []*model.User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// SetPendingEmail never checks other users: several may request the same
+// address, and ConfirmEmail settles who verified it first.
+func (s *SQLiteUserStore) SetPendingEmail(ctx context.Context, userID int64, email string) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE users SET pending_email = ? WHERE id = ?`, email, userID)
+	return err
+}
+
+func (s *SQLiteUserStore) ConfirmEmail(ctx context.Context, userID int64, email string) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE users SET email = ?, email_verified = 1,
+		   pending_email = CASE WHEN pending_email = ? THEN NULL ELSE pending_email END
+		 WHERE id = ? AND (email = ? OR pending_email = ?)`,
+		email, email, userID, email, email)
+	if isEmailConstraintErr(err) {
+		return false, store.ErrEmailTaken
+	}
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *SQLiteUserStore) GetUserByID(ctx context.Context, id int64) (*model.User, error) {
+	return scanUser(s.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = ?`, id))
+}
+
+// scanUser reads a row selected with userColumns; (nil, nil) if there is none.
+func scanUser(row scanner) (*model.User, error) {
 	var u model.User
+	var email, pendingEmail, deletedAt sql.NullString
+	var emailVerified, disabled int
 	var createdAt string
-	if err := row.Scan(&u.ID, &u.Username, &u.Password, &createdAt); err != nil {
+	if err := row.Scan(&u.ID, &u.Username, &u.Password, &email, &emailVerified, &pendingEmail, &disabled, &createdAt, &deletedAt); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
 		return nil, err
 	}
+	u.Email = email.String
+	u.EmailVerified = emailVerified != 0
+	u.PendingEmail = pendingEmail.String
+	u.Disabled = disabled != 0
 	if t, err := time.Parse(time.RFC3339Nano, createdAt); err == nil {
 		u.CreatedAt = t
 	}
+	if t, err := time.Parse(time.RFC3339Nano, deletedAt.String); err == nil {
+		u.DeletedAt = &t
+	}
 	return &u, nil
 }
 
@@ -87,29 +311,87 @@ func (s *SQLiteUserStore) StoreRefreshToken(ctx context.Context, userID int64, t
 }
 
 // CreateRefreshToken inserts a new refresh token row and returns its id.
-func (s *SQLiteUserStore) CreateRefreshToken(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time, deviceInfo *string) (int64, error) {
-	q := `INSERT INTO refresh_tokens (user_id, token_hash, created_at, expires_at, revoked, device_info) VALUES (?, ?, ?, ?, 0, ?)`
-	res, err := s.db.ExecContext(ctx, q, userID, tokenHash, time.Now().UTC().Format(time.RFC3339Nano), expiresAt.Format(time.RFC3339Nano), deviceInfo)
+func (s *SQLiteUserStore) CreateRefreshToken(ctx context.Context, rt *model.RefreshToken) (int64, error) {
+	// Unique constraint on token_hash -> treat as error
+	return insertRefreshToken(ctx, s.db, rt)
+}
+
+// RotateRefreshToken revokes oldID and inserts its successor in one transaction.
+// The revoke is a compare-and-swap on revoked = 0, so of several concurrent
+// rotations of the same token exactly one succeeds.
+func (s *SQLiteUserStore) RotateRefreshToken(ctx context.Context, oldID int64, next *model.RefreshToken) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE refresh_tokens SET revoked = 1 WHERE id = ? AND revoked = 0`, oldID)
+	if err != nil {
+		return 0, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return 0, err
+	} else if n == 0 {
+		return 0, store.ErrRefreshTokenReused
+	}
+
+	newID, err := insertRefreshToken(ctx, tx, next)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE refresh_tokens SET replaced_by = ? WHERE id = ?`, newID, oldID); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func insertRefreshToken(ctx context.Context, db execer, rt *model.RefreshToken) (int64, error) {
+	res, err := db.ExecContext(ctx,
+		`INSERT INTO refresh_tokens (user_id, token_hash, created_at, expires_at, revoked, device_info, family_id, client_type, session_started_at, remember_me, user_agent, client_ip)
+		 VALUES (?, ?, ?, ?, 0, ?, ?, ?, ?, ?, ?, ?)`,
+		rt.UserID, rt.TokenHash, time.Now().UTC().Format(time.RFC3339Nano), rt.ExpiresAt.UTC().Format(time.RFC3339Nano),
+		rt.DeviceInfo, nullString(rt.FamilyID), nullString(rt.ClientType), nullTime(rt.SessionStartedAt), rt.RememberMe,
+		nullString(rt.UserAgent), nullString(rt.ClientIP))
 	if err != nil {
-		// Unique constraint on token_hash -> treat as error
 		return 0, err
 	}
 	return res.LastInsertId()
 }
 
+const refreshTokenColumns = `id, user_id, token_hash, created_at, expires_at, revoked, replaced_by, device_info, family_id, client_type, session_started_at, remember_me, user_agent, client_ip`
+
 // GetRefreshTokenByHash returns the refresh token row or nil if not found.
 func (s *SQLiteUserStore) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*model.RefreshToken, error) {
-	row := s.db.QueryRowContext(ctx, `SELECT id, user_id, token_hash, created_at, expires_at, revoked, replaced_by, device_info FROM refresh_tokens WHERE token_hash = ?`, tokenHash)
+	row := s.db.QueryRowContext(ctx, `SELECT `+refreshTokenColumns+` FROM refresh_tokens WHERE token_hash = ?`, tokenHash)
+	rt, err := scanRefreshToken(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return rt, err
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanRefreshToken reads a row selected with refreshTokenColumns.
+func scanRefreshToken(row scanner) (*model.RefreshToken, error) {
 	var rt model.RefreshToken
 	var createdAtStr, expiresAtStr string
-	var revokedInt int
+	var revokedInt, rememberMe int
 	var replacedBy sql.NullInt64
-	var deviceInfo sql.NullString
+	var deviceInfo, familyID, clientType, sessionStarted, userAgent, clientIP sql.NullString
 
-	if err := row.Scan(&rt.ID, &rt.UserID, &rt.TokenHash, &createdAtStr, &expiresAtStr, &revokedInt, &replacedBy, &deviceInfo); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
-		}
+	if err := row.Scan(&rt.ID, &rt.UserID, &rt.TokenHash, &createdAtStr, &expiresAtStr, &revokedInt, &replacedBy, &deviceInfo,
+		&familyID, &clientType, &sessionStarted, &rememberMe, &userAgent, &clientIP); err != nil {
 		return nil, err
 	}
 	rt.Revoked = revokedInt != 0
@@ -121,6 +403,14 @@ func (s *SQLiteUserStore) GetRefreshTokenByHash(ctx context.Context, tokenHash s
 		d := deviceInfo.String
 		rt.DeviceInfo = &d
 	}
+	rt.FamilyID = familyID.String
+	rt.ClientType = clientType.String
+	rt.RememberMe = rememberMe != 0
+	rt.UserAgent = userAgent.String
+	rt.ClientIP = clientIP.String
+	if t, err := time.Parse(time.RFC3339Nano, sessionStarted.String); err == nil {
+		rt.SessionStartedAt = t
+	}
 	if t, err := time.Parse(time.RFC3339Nano, createdAtStr); err == nil {
 		rt.CreatedAt = t
 	}
@@ -130,6 +420,17 @@ func (s *SQLiteUserStore) GetRefreshTokenByHash(ctx context.Context, tokenHash s
 	return &rt, nil
 }
 
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func nullTime(t time.Time) sql.NullString {
+	if t.IsZero() {
+		return sql.NullString{}
+	}
+	return nullString(t.UTC().Format(time.RFC3339Nano))
+}
+
 // MarkRefreshTokenRevokedAndSetReplacement marks token id as revoked and sets replaced_by = replacedBy.
 func (s *SQLiteUserStore) MarkRefreshTokenRevokedAndSetReplacement(ctx context.Context, id, replacedBy int64) error {
 	_, err := s.db.ExecContext(ctx, `UPDATE refresh_tokens SET revoked = 1, replaced_by = ? WHERE id = ?`, replacedBy, id)
@@ -142,6 +443,114 @@ func (s *SQLiteUserStore) RevokeAllRefreshTokensForUser(ctx context.Context, use
 	return err
 }
 
+func (s *SQLiteUserStore) RevokeOtherSessions(ctx context.Context, userID int64, keepFamilyID string) ([]string, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT DISTINCT family_id FROM refresh_tokens WHERE user_id = ? AND family_id IS NOT NULL AND family_id != ?`,
+		userID, keepFamilyID)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE refresh_tokens SET revoked = 1 WHERE user_id = ? AND revoked = 0 AND (family_id IS NULL OR family_id != ?)`,
+		userID, keepFamilyID); err != nil {
+		return nil, err
+	}
+	return ids, tx.Commit()
+}
+
+// RevokeRefreshTokenFamily sets revoked=1 for every token descended from one login.
+func (s *SQLiteUserStore) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE refresh_tokens SET revoked = 1 WHERE family_id = ?`, familyID)
+	return err
+}
+
+// ListSessions returns the user's live token families, most recently used first.
+// Each family has at most one unrevoked token, whose creation is the last use.
+func (s *SQLiteUserStore) ListSessions(ctx context.Context, userID int64) ([]model.Session, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+refreshTokenColumns+` FROM refresh_tokens
+		WHERE user_id = ? AND revoked = 0 AND family_id IS NOT NULL AND julianday(expires_at) > julianday(?)
+		ORDER BY julianday(created_at) DESC`, userID, time.Now().UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []model.Session{}
+	for rows.Next() {
+		rt, err := scanRefreshToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		sess := model.Session{
+			ID:         rt.FamilyID,
+			UserAgent:  rt.UserAgent,
+			ClientIP:   rt.ClientIP,
+			ClientType: rt.ClientType,
+			CreatedAt:  rt.SessionStartedAt,
+			LastUsedAt: rt.CreatedAt,
+			ExpiresAt:  rt.ExpiresAt,
+		}
+		if rt.DeviceInfo != nil {
+			sess.DeviceName = *rt.DeviceInfo
+		}
+		if sess.CreatedAt.IsZero() {
+			sess.CreatedAt = rt.CreatedAt
+		}
+		sessions = append(sessions, sess)
+	}
+	return sessions, rows.Err()
+}
+
+// RevokeSession revokes the user's token family familyID. It reports false if
+// the user has no live token in that family.
+func (s *SQLiteUserStore) RevokeSession(ctx context.Context, userID int64, familyID string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `UPDATE refresh_tokens SET revoked = 1 WHERE user_id = ? AND family_id = ? AND revoked = 0`, userID, familyID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// RevokeRefreshToken sets revoked=1 for a single token.
+func (s *SQLiteUserStore) RevokeRefreshToken(ctx context.Context, id int64) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE refresh_tokens SET revoked = 1 WHERE id = ?`, id)
+	return err
+}
+
+// RevokeRefreshTokenChain sets revoked=1 for id and all tokens it was rotated into.
+func (s *SQLiteUserStore) RevokeRefreshTokenChain(ctx context.Context, id int64) error {
+	_, err := s.db.ExecContext(ctx, `
+WITH RECURSIVE chain(id) AS (
+	SELECT id FROM refresh_tokens WHERE id = ?
+	UNION
+	SELECT rt.replaced_by FROM refresh_tokens rt JOIN chain c ON rt.id = c.id
+	WHERE rt.replaced_by IS NOT NULL AND rt.replaced_by <> 0
+)
+UPDATE refresh_tokens SET revoked = 1 WHERE id IN (SELECT id FROM chain)`, id)
+	return err
+}
+
 func isUniqueConstraintErr(err error) bool {
 	if err == nil {
 		return false
@@ -150,6 +559,11 @@ func isUniqueConstraintErr(err error) bool {
 	return contains(err.Error(), "UNIQUE constraint failed")
 }
 
+// isEmailConstraintErr reports a unique violation on verified users.email.
+func isEmailConstraintErr(err error) bool {
+	return isUniqueConstraintErr(err) && contains(err.Error(), "users.email")
+}
+
 func contains(s, sub string) bool {
 	return indexOf(s, sub) >= 0
 }
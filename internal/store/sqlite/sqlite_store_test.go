@@ -0,0 +1,105 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prfc0/authN/internal/model"
+	"github.com/prfc0/authN/internal/store"
+	"github.com/prfc0/authN/internal/username"
+)
+
+// openTestDB returns a migrated database in a temporary directory.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := Open(filepath.Join(t.TempDir(), "auth.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := Migrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+func TestRotateRefreshTokenConcurrentReuse(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	s := NewSQLiteUserStore(db)
+
+	userID, err := s.CreateUser(ctx, username.Canonicalize("alice"), "", "hash")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	const family = "family-1"
+	expires := time.Now().Add(time.Hour)
+	oldID, err := s.CreateRefreshToken(ctx, &model.RefreshToken{
+		UserID: userID, TokenHash: "old", ExpiresAt: expires, FamilyID: family,
+	})
+	if err != nil {
+		t.Fatalf("create refresh token: %v", err)
+	}
+
+	const n = 16
+	var (
+		wg     sync.WaitGroup
+		start  = make(chan struct{})
+		errs   = make([]error, n)
+		newIDs = make([]int64, n)
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			newIDs[i], errs[i] = s.RotateRefreshToken(ctx, oldID, &model.RefreshToken{
+				UserID: userID, TokenHash: fmt.Sprintf("next-%d", i), ExpiresAt: expires, FamilyID: family,
+			})
+			// like the refresh handler, a caller that lost the race treats it as reuse
+			if errors.Is(errs[i], store.ErrRefreshTokenReused) {
+				if err := s.RevokeRefreshTokenFamily(ctx, family); err != nil {
+					t.Errorf("revoke family: %v", err)
+				}
+			}
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	var won, reused int
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			won++
+			if newIDs[i] == 0 {
+				t.Errorf("caller %d won without a successor ID", i)
+			}
+		case errors.Is(err, store.ErrRefreshTokenReused):
+			reused++
+		default:
+			t.Errorf("caller %d: unexpected error: %v", i, err)
+		}
+	}
+	if won != 1 || reused != n-1 {
+		t.Fatalf("got %d successful rotations and %d reuse errors, want 1 and %d", won, reused, n-1)
+	}
+
+	var total, live int
+	err = db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(revoked = 0), 0) FROM refresh_tokens WHERE family_id = ?`, family).Scan(&total, &live)
+	if err != nil {
+		t.Fatalf("count family: %v", err)
+	}
+	if total != 2 {
+		t.Errorf("family has %d tokens, want the original and one successor", total)
+	}
+	if live != 0 {
+		t.Errorf("family has %d unrevoked tokens after reuse, want 0", live)
+	}
+}
@@ -6,21 +6,84 @@ import (
 	"time"
 
 	"github.com/prfc0/authN/internal/model"
+	"github.com/prfc0/authN/internal/username"
 )
 
 var (
 	// ErrUserExists is returned when trying to create a user with an existing username.
 	ErrUserExists = errors.New("user already exists")
+	// ErrEmailTaken is returned when an email address belongs to another user.
+	ErrEmailTaken = errors.New("email address already in use")
+	// ErrRefreshTokenReused is returned by RotateRefreshToken when the token
+	// was already rotated or revoked by the time the rotation ran.
+	ErrRefreshTokenReused = errors.New("refresh token already used")
 )
 
 type UserStore interface {
-	// CreateUser stores username and hashed password and returns new ID.
-	CreateUser(ctx context.Context, username, passwordHash string) (int64, error)
-	// GetUserByUsername returns user or (nil, nil) if not found.
-	GetUserByUsername(ctx context.Context, username string) (*model.User, error)
+	// CreateUser stores the username forms, unverified email (may be empty)
+	// and hashed password and returns new ID. ErrUserExists is returned if the
+	// canonical form or skeleton is taken. A non-empty email is recorded as the
+	// pending address until ConfirmEmail.
+	CreateUser(ctx context.Context, name username.Name, email, passwordHash string) (int64, error)
+	// GetUserByUsername looks the user up by canonical form; (nil, nil) if not found.
+	GetUserByUsername(ctx context.Context, name username.Name) (*model.User, error)
+	// GetUserByID returns user or (nil, nil) if not found.
+	GetUserByID(ctx context.Context, id int64) (*model.User, error)
+	// UpdatePasswordHash replaces the user's stored password hash.
+	UpdatePasswordHash(ctx context.Context, userID int64, passwordHash string) error
+	// DeleteUser removes the user; refresh and one-time tokens go with it.
+	// Access token cutoffs stay, so revoke the user's access tokens first.
+	DeleteUser(ctx context.Context, userID int64) error
+	// SoftDeleteUser marks the user deleted as of at, keeping the row for a
+	// later RestoreUser.
+	SoftDeleteUser(ctx context.Context, userID int64, at time.Time) error
+	// RestoreUser undoes SoftDeleteUser if the user was deleted no earlier
+	// than since, reporting whether it did.
+	RestoreUser(ctx context.Context, userID int64, since time.Time) (bool, error)
+	// GetUserByEmail returns the user who verified email, or (nil, nil).
+	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
+	// ListUsersByPendingEmail returns up to limit users, newest first, waiting
+	// to verify email. Unverified addresses are not unique.
+	ListUsersByPendingEmail(ctx context.Context, email string, limit int) ([]*model.User, error)
+	// SetPendingEmail records email as the user's requested new address. It
+	// does not check other users; ConfirmEmail does.
+	SetPendingEmail(ctx context.Context, userID int64, email string) error
+	// ConfirmEmail makes email the user's verified address, provided it is
+	// still their current or pending address; otherwise it reports false.
+	// ErrEmailTaken is returned if another user verified it first.
+	ConfirmEmail(ctx context.Context, userID int64, email string) (bool, error)
 	StoreRefreshToken(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time) error
-	CreateRefreshToken(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time, deviceInfo *string) (int64, error)
+	// CreateRefreshToken inserts rt (UserID, TokenHash, ExpiresAt, DeviceInfo, FamilyID) and returns its ID.
+	CreateRefreshToken(ctx context.Context, rt *model.RefreshToken) (int64, error)
 	GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*model.RefreshToken, error)
 	MarkRefreshTokenRevokedAndSetReplacement(ctx context.Context, id, replacedBy int64) error
 	RevokeAllRefreshTokensForUser(ctx context.Context, userID int64) error
+	// RevokeOtherSessions revokes every refresh token of the user except those
+	// of the session keepFamilyID, and returns the IDs of all the user's other
+	// sessions on record, ended earlier or not, so their access tokens can be
+	// revoked too.
+	RevokeOtherSessions(ctx context.Context, userID int64, keepFamilyID string) ([]string, error)
+	// RotateRefreshToken atomically revokes oldID, provided it is not already
+	// revoked, and inserts next as its successor, returning the successor's ID.
+	// If oldID was already revoked nothing is written and ErrRefreshTokenReused is returned.
+	RotateRefreshToken(ctx context.Context, oldID int64, next *model.RefreshToken) (int64, error)
+	// RevokeRefreshTokenFamily revokes every token rotated from the same login.
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string) error
+	// ListSessions returns the user's active sessions (token families).
+	ListSessions(ctx context.Context, userID int64) ([]model.Session, error)
+	// RevokeSession revokes one of the user's sessions, reporting false if it
+	// is not active or belongs to someone else.
+	RevokeSession(ctx context.Context, userID int64, familyID string) (bool, error)
+	// RevokeRefreshToken revokes a single refresh token row.
+	RevokeRefreshToken(ctx context.Context, id int64) error
+	// RevokeRefreshTokenChain revokes id and every successor reachable through replaced_by.
+	RevokeRefreshTokenChain(ctx context.Context, id int64) error
+	// CreateOneTimeToken records an issued action token, invalidating the
+	// user's unused tokens for the same purpose.
+	CreateOneTimeToken(ctx context.Context, t *model.OneTimeToken) error
+	// GetOneTimeToken returns the token if it is unused and unexpired, or (nil, nil).
+	GetOneTimeToken(ctx context.Context, id, purpose string) (*model.OneTimeToken, error)
+	// ConsumeOneTimeToken marks the token used and returns it, or (nil, nil) if
+	// it is unknown, for another purpose, already used or expired.
+	ConsumeOneTimeToken(ctx context.Context, id, purpose string) (*model.OneTimeToken, error)
 }
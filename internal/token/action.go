@@ -0,0 +1,77 @@
+package token
+
+import (
+	"errors"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+// Purposes of action tokens and other one-time tokens.
+const (
+	PurposeEmailVerification = "email_verification"
+	// PurposePasswordReset tokens are opaque; see GenerateOpaqueToken.
+	PurposePasswordReset = "password_reset"
+)
+
+// ActionClaims is the claim set of an action token: a short-lived, signed
+// link token that authorizes one specific action, such as confirming an email
+// address. They carry no "sub", so they are never accepted as access tokens.
+// The jti identifies the single-use record the caller keeps for the token.
+type ActionClaims struct {
+	Purpose string `json:"purpose"`
+	UserID  int64  `json:"uid"`
+	Email   string `json:"email,omitempty"`
+
+	jwt.RegisteredClaims
+}
+
+// GenerateActionToken signs an action token for userID valid for ttl and
+// returns it with its claims.
+func (m *TokenManager) GenerateActionToken(purpose string, userID int64, email string, ttl time.Duration) (string, *ActionClaims, error) {
+	key := m.keys.Active()
+	if err := checkKey(key); err != nil {
+		return "", nil, err
+	}
+	jti, err := newTokenID()
+	if err != nil {
+		return "", nil, err
+	}
+	now := time.Now()
+	claims := &ActionClaims{
+		Purpose: purpose,
+		UserID:  userID,
+		Email:   email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    m.issuer,
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        jti,
+		},
+	}
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.ID()
+	signed, err := token.SignedString(key.private)
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, claims, nil
+}
+
+// VerifyActionToken checks the signature, expiry and issuer of an action
+// token and that it was issued for purpose. Single use is up to the caller.
+func (m *TokenManager) VerifyActionToken(tokenStr, purpose string) (*ActionClaims, error) {
+	opts := []jwt.ParserOption{jwt.WithLeeway(m.leeway), jwt.WithExpirationRequired()}
+	if m.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(m.issuer))
+	}
+	claims := &ActionClaims{}
+	token, err := jwt.ParseWithClaims(tokenStr, claims, m.verificationKey, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid || claims.Purpose != purpose || claims.ID == "" || claims.UserID == 0 {
+		return nil, errors.New("invalid action token")
+	}
+	return claims, nil
+}
@@ -0,0 +1,151 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+// Claims is the typed claim set carried by access tokens. The registered JWT
+// claims (iss, sub, aud, exp, nbf, iat, jti) come from the embedded
+// RegisteredClaims; Subject always mirrors UserID.
+type Claims struct {
+	UserID    int64
+	Username  string
+	Scopes    []string
+	Roles     []string
+	SessionID string
+	AuthTime  time.Time
+	AMR       []string
+	// Custom holds any additional claims; keys must not collide with the
+	// names in ReservedClaims.
+	Custom map[string]interface{}
+
+	jwt.RegisteredClaims
+}
+
+// ReservedClaims lists claim names owned by Claims itself.
+var ReservedClaims = map[string]bool{
+	"iss": true, "sub": true, "aud": true, "exp": true, "nbf": true, "iat": true, "jti": true,
+	"username": true, "scope": true, "roles": true, "sid": true, "auth_time": true, "amr": true,
+}
+
+// HasScope reports whether the token was granted scope.
+func (c *Claims) HasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRole reports whether the token carries role.
+func (c *Claims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalJSON flattens the typed fields, registered claims and custom claims
+// into a single JWT payload object.
+func (c Claims) MarshalJSON() ([]byte, error) {
+	out := make(map[string]interface{}, len(c.Custom)+12)
+	for k, v := range c.Custom {
+		if ReservedClaims[k] {
+			return nil, fmt.Errorf("custom claim %q is reserved", k)
+		}
+		out[k] = v
+	}
+
+	reg, err := json.Marshal(c.RegisteredClaims)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(reg, &out); err != nil {
+		return nil, err
+	}
+
+	out["sub"] = strconv.FormatInt(c.UserID, 10)
+	out["username"] = c.Username
+	if len(c.Scopes) > 0 {
+		out["scope"] = strings.Join(c.Scopes, " ")
+	}
+	if len(c.Roles) > 0 {
+		out["roles"] = c.Roles
+	}
+	if c.SessionID != "" {
+		out["sid"] = c.SessionID
+	}
+	if !c.AuthTime.IsZero() {
+		out["auth_time"] = c.AuthTime.Unix()
+	}
+	if len(c.AMR) > 0 {
+		out["amr"] = c.AMR
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON is the inverse of MarshalJSON. Tokens whose "sub" is not a
+// numeric user ID are rejected.
+func (c *Claims) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &c.RegisteredClaims); err != nil {
+		return err
+	}
+
+	id, err := strconv.ParseInt(c.Subject, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid sub %q", c.Subject)
+	}
+	c.UserID = id
+
+	var (
+		scope    string
+		authTime *jwt.NumericDate
+	)
+	fields := map[string]interface{}{
+		"username":  &c.Username,
+		"scope":     &scope,
+		"roles":     &c.Roles,
+		"sid":       &c.SessionID,
+		"auth_time": &authTime,
+		"amr":       &c.AMR,
+	}
+	for name, dst := range fields {
+		if v, ok := raw[name]; ok {
+			if err := json.Unmarshal(v, dst); err != nil {
+				return fmt.Errorf("invalid %s claim: %w", name, err)
+			}
+		}
+	}
+	c.Scopes = strings.Fields(scope)
+	if authTime != nil {
+		c.AuthTime = authTime.Time
+	}
+
+	for k, v := range raw {
+		if ReservedClaims[k] {
+			continue
+		}
+		var val interface{}
+		if err := json.Unmarshal(v, &val); err != nil {
+			return err
+		}
+		if c.Custom == nil {
+			c.Custom = make(map[string]interface{})
+		}
+		c.Custom[k] = val
+	}
+	return nil
+}
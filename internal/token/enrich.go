@@ -0,0 +1,77 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+
+	"github.com/prfc0/authN/internal/model"
+)
+
+// DefaultMaxTokenSize bounds signed access tokens so they still fit comfortably
+// in an Authorization header.
+const DefaultMaxTokenSize = 4096
+
+var (
+	// ErrReservedClaim is returned when an enricher sets a custom claim whose
+	// name is owned by Claims (see ReservedClaims).
+	ErrReservedClaim = errors.New("reserved claim name")
+	// ErrTokenTooLarge is returned when a signed token exceeds the size limit.
+	ErrTokenTooLarge = errors.New("access token too large")
+)
+
+// ClaimsEnricher lets integrators add claims (tenant, roles, entitlements, ...)
+// to access tokens. It runs on every login and refresh. Enrichers may set
+// Scopes, Roles and Custom; changes to identity and registered claims are
+// discarded.
+type ClaimsEnricher interface {
+	EnrichClaims(ctx context.Context, user *model.User, claims *Claims) error
+}
+
+// ClaimsEnricherFunc adapts a function to ClaimsEnricher.
+type ClaimsEnricherFunc func(ctx context.Context, user *model.User, claims *Claims) error
+
+func (f ClaimsEnricherFunc) EnrichClaims(ctx context.Context, user *model.User, claims *Claims) error {
+	return f(ctx, user, claims)
+}
+
+// WithClaimsEnricher installs e to run whenever BuildClaims is called.
+func WithClaimsEnricher(e ClaimsEnricher) Option {
+	return func(m *TokenManager) { m.enricher = e }
+}
+
+// WithMaxTokenSize sets the largest signed token GenerateAccessToken will
+// return; zero disables the limit.
+func WithMaxTokenSize(n int) Option {
+	return func(m *TokenManager) { m.maxTokenSize = n }
+}
+
+// BuildClaims returns the claim set for user's next access token, including
+// whatever the configured enricher adds.
+func (m *TokenManager) BuildClaims(ctx context.Context, user *model.User) (*Claims, error) {
+	claims := &Claims{UserID: user.ID, Username: user.Username}
+	if m.enricher == nil {
+		return claims, nil
+	}
+
+	if err := m.enricher.EnrichClaims(ctx, user, claims); err != nil {
+		return nil, fmt.Errorf("enrich claims: %w", err)
+	}
+	for k := range claims.Custom {
+		if ReservedClaims[k] {
+			return nil, fmt.Errorf("%w: %q", ErrReservedClaim, k)
+		}
+	}
+
+	// identity and registered claims belong to the token manager
+	claims.UserID = user.ID
+	claims.Username = user.Username
+	claims.SessionID = ""
+	claims.AuthTime = time.Time{}
+	claims.AMR = nil
+	claims.RegisteredClaims = jwt.RegisteredClaims{}
+	return claims, nil
+}
@@ -0,0 +1,83 @@
+package token
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+)
+
+// JWK is the public half of a signing key in RFC 7517 form.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC / OKP
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet is the document served from a jwks_uri.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK returns the public key as a JWK. Symmetric keys have no public half
+// and report false.
+func (k *SigningKey) JWK() (JWK, bool) {
+	j := JWK{Kid: k.ID(), Use: "sig", Alg: k.Algorithm()}
+	switch pub := k.public.(type) {
+	case *rsa.PublicKey:
+		j.Kty = "RSA"
+		j.N = b64(pub.N.Bytes())
+		j.E = b64(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		j.Kty = "EC"
+		j.Crv = pub.Curve.Params().Name
+		j.X = b64(pub.X.FillBytes(make([]byte, size)))
+		j.Y = b64(pub.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		j.Kty = "OKP"
+		j.Crv = "Ed25519"
+		j.X = b64(pub)
+	default:
+		return JWK{}, false
+	}
+	return j, true
+}
+
+// PublicJWKSet returns the public halves of every key the ring still trusts.
+func (r *KeyRing) PublicJWKSet() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, k := range r.VerificationKeys() {
+		if j, ok := k.JWK(); ok {
+			set.Keys = append(set.Keys, j)
+		}
+	}
+	return set
+}
+
+// Algorithms returns the distinct "alg" values of keys the ring still trusts,
+// active key first.
+func (r *KeyRing) Algorithms() []string {
+	var algs []string
+	seen := map[string]bool{}
+	for _, k := range r.VerificationKeys() {
+		if !seen[k.Algorithm()] {
+			seen[k.Algorithm()] = true
+			algs = append(algs, k.Algorithm())
+		}
+	}
+	return algs
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,177 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultRetireAfter is how long a rotated-out key keeps verifying tokens.
+// It comfortably exceeds the access token TTL so outstanding tokens age out
+// before their key is retired.
+const DefaultRetireAfter = 20 * time.Minute
+
+var (
+	// ErrUnknownKey is returned when a token names a kid the ring has never held.
+	ErrUnknownKey = errors.New("unknown signing key")
+	// ErrKeyRetired is returned when a token names a kid that has been retired.
+	ErrKeyRetired = errors.New("signing key retired")
+)
+
+// KeyState describes what a key in the ring may be used for.
+type KeyState int
+
+const (
+	// KeyActive signs new tokens and verifies existing ones.
+	KeyActive KeyState = iota
+	// KeyVerifyOnly verifies tokens until its retirement time.
+	KeyVerifyOnly
+	// KeyRetired is rejected outright.
+	KeyRetired
+)
+
+func (s KeyState) String() string {
+	switch s {
+	case KeyActive:
+		return "active"
+	case KeyVerifyOnly:
+		return "verify-only"
+	default:
+		return "retired"
+	}
+}
+
+type ringKey struct {
+	key      *SigningKey
+	state    KeyState
+	retireAt time.Time // only meaningful for KeyVerifyOnly
+}
+
+// KeyRing holds the signing keys known to a TokenManager. Exactly one key is
+// active; keys rotated out stay verify-only for retireAfter and are then
+// treated as retired. It is safe for concurrent use.
+type KeyRing struct {
+	mu          sync.RWMutex
+	keys        map[string]*ringKey
+	activeID    string
+	retireAfter time.Duration
+}
+
+// RetireAfterFor returns how long rotated-out keys must keep verifying so that
+// no token valid for up to maxTTL is rejected before it expires: retireAfter,
+// raised if needed to maxTTL plus the verification leeway.
+func RetireAfterFor(retireAfter, maxTTL, leeway time.Duration) time.Duration {
+	return max(retireAfter, maxTTL+leeway)
+}
+
+// NewKeyRing returns a ring with active as the signing key. Rotated-out keys
+// keep verifying for retireAfter (DefaultRetireAfter if zero).
+func NewKeyRing(active *SigningKey, retireAfter time.Duration) *KeyRing {
+	if retireAfter <= 0 {
+		retireAfter = DefaultRetireAfter
+	}
+	r := &KeyRing{keys: make(map[string]*ringKey), retireAfter: retireAfter}
+	r.keys[active.ID()] = &ringKey{key: active, state: KeyActive}
+	r.activeID = active.ID()
+	return r
+}
+
+// Active returns the key currently used for signing.
+func (r *KeyRing) Active() *SigningKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.keys[r.activeID].key
+}
+
+// Rotate makes next the active key and demotes the previous active key to
+// verify-only. Rotating to the key that is already active is a no-op.
+func (r *KeyRing) Rotate(next *SigningKey) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if next.ID() == r.activeID {
+		return
+	}
+	if prev, ok := r.keys[r.activeID]; ok {
+		prev.state = KeyVerifyOnly
+		prev.retireAt = time.Now().Add(r.retireAfter)
+	}
+	r.keys[next.ID()] = &ringKey{key: next, state: KeyActive}
+	r.activeID = next.ID()
+}
+
+// AddVerificationKey adds a key that verifies but never signs, e.g. the
+// previous key loaded at startup so a restart mid-rotation keeps its tokens valid.
+func (r *KeyRing) AddVerificationKey(k *SigningKey) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.keys[k.ID()]; ok {
+		return
+	}
+	r.keys[k.ID()] = &ringKey{key: k, state: KeyVerifyOnly, retireAt: time.Now().Add(r.retireAfter)}
+}
+
+// Retire immediately stops a verify-only key from verifying tokens.
+// The active key cannot be retired; rotate away from it first.
+func (r *KeyRing) Retire(kid string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rk, ok := r.keys[kid]
+	if !ok {
+		return ErrUnknownKey
+	}
+	if kid == r.activeID {
+		return errors.New("cannot retire the active signing key")
+	}
+	rk.state = KeyRetired
+	return nil
+}
+
+// Lookup returns the key for kid if it may still verify tokens.
+func (r *KeyRing) Lookup(kid string) (*SigningKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	rk, ok := r.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if r.stateOf(rk, time.Now()) == KeyRetired {
+		return nil, fmt.Errorf("%w: %s", ErrKeyRetired, kid)
+	}
+	return rk.key, nil
+}
+
+// State reports the current state of kid.
+func (r *KeyRing) State(kid string) (KeyState, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	rk, ok := r.keys[kid]
+	if !ok {
+		return KeyRetired, ErrUnknownKey
+	}
+	return r.stateOf(rk, time.Now()), nil
+}
+
+func (r *KeyRing) stateOf(rk *ringKey, now time.Time) KeyState {
+	if rk.state == KeyVerifyOnly && now.After(rk.retireAt) {
+		return KeyRetired
+	}
+	return rk.state
+}
+
+// VerificationKeys returns every key that may still verify tokens, active key first.
+func (r *KeyRing) VerificationKeys() []*SigningKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	now := time.Now()
+	out := []*SigningKey{r.keys[r.activeID].key}
+	var rest []*SigningKey
+	for id, rk := range r.keys {
+		if id != r.activeID && r.stateOf(rk, now) == KeyVerifyOnly {
+			rest = append(rest, rk.key)
+		}
+	}
+	sort.Slice(rest, func(i, j int) bool { return rest[i].ID() < rest[j].ID() })
+	return append(out, rest...)
+}
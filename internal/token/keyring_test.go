@@ -0,0 +1,51 @@
+package token
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetireAfterFor(t *testing.T) {
+	tests := []struct {
+		name                        string
+		retireAfter, maxTTL, leeway time.Duration
+		want                        time.Duration
+	}{
+		{"default outlasts tokens", DefaultRetireAfter, 15 * time.Minute, 30 * time.Second, DefaultRetireAfter},
+		{"raised for long tokens", DefaultRetireAfter, time.Hour, 30 * time.Second, time.Hour + 30*time.Second},
+		{"exactly enough", time.Hour + 30*time.Second, time.Hour, 30 * time.Second, time.Hour + 30*time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RetireAfterFor(tt.retireAfter, tt.maxTTL, tt.leeway); got != tt.want {
+				t.Errorf("RetireAfterFor() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRotatedKeyOutlivesItsTokens(t *testing.T) {
+	// the README's cli=1h/12h example: hour-long tokens against the 20m default
+	const ttl = time.Hour
+	old := NewHMACKey([]byte("old secret"))
+	ring := NewKeyRing(old, RetireAfterFor(DefaultRetireAfter, ttl, DefaultLeeway))
+	m := NewManagerWithKeyRing(ring, nil)
+
+	raw, err := m.GenerateAccessToken(&Claims{UserID: 1}, "", int64(ttl/time.Second))
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	claims, err := m.VerifyAccessToken(raw, "")
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	m.RotateSigningKey(NewHMACKey([]byte("new secret")))
+
+	if _, err := m.VerifyAccessToken(raw, ""); err != nil {
+		t.Fatalf("verify after rotation: %v", err)
+	}
+	retireAt := ring.keys[old.ID()].retireAt
+	if last := claims.ExpiresAt.Add(DefaultLeeway); retireAt.Before(last) {
+		t.Errorf("old key retires at %s, before its last token stops verifying at %s", retireAt, last)
+	}
+}
@@ -0,0 +1,157 @@
+package token
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey pairs a JWT signing method with the key material it needs.
+// For HMAC both halves are the shared secret; for RSA, ECDSA and Ed25519 the
+// private key signs and the public key verifies, so verifiers can be handed
+// the public half without being able to mint tokens.
+type SigningKey struct {
+	id      string
+	method  jwt.SigningMethod
+	private interface{}
+	public  interface{}
+}
+
+// NewHMACKey returns an HS256 key backed by a shared secret.
+func NewHMACKey(secret []byte) *SigningKey {
+	return withKeyID(&SigningKey{method: jwt.SigningMethodHS256, private: secret, public: secret}, secret)
+}
+
+// NewSigningKey wraps an RSA, ECDSA or Ed25519 private key and picks the
+// matching algorithm (RS256, ES256/ES384/ES512 by curve, or EdDSA).
+func NewSigningKey(priv crypto.Signer) (*SigningKey, error) {
+	switch k := priv.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < 2048 {
+			return nil, errors.New("rsa key must be at least 2048 bits")
+		}
+		return newAsymmetricKey(jwt.SigningMethodRS256, k, &k.PublicKey)
+	case *ecdsa.PrivateKey:
+		var m jwt.SigningMethod
+		switch k.Curve {
+		case elliptic.P256():
+			m = jwt.SigningMethodES256
+		case elliptic.P384():
+			m = jwt.SigningMethodES384
+		case elliptic.P521():
+			m = jwt.SigningMethodES512
+		default:
+			return nil, fmt.Errorf("unsupported ecdsa curve: %s", k.Curve.Params().Name)
+		}
+		return newAsymmetricKey(m, k, &k.PublicKey)
+	case ed25519.PrivateKey:
+		return newAsymmetricKey(jwt.SigningMethodEdDSA, k, k.Public())
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", priv)
+	}
+}
+
+func newAsymmetricKey(method jwt.SigningMethod, priv, pub interface{}) (*SigningKey, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, fmt.Errorf("encode public key: %w", err)
+	}
+	return withKeyID(&SigningKey{method: method, private: priv, public: pub}, der), nil
+}
+
+// withKeyID derives a stable key ID from the key material so every instance
+// loading the same key advertises the same "kid".
+func withKeyID(k *SigningKey, material []byte) *SigningKey {
+	h := sha256.Sum256(append([]byte(k.method.Alg()+":"), material...))
+	k.id = hex.EncodeToString(h[:8])
+	return k
+}
+
+// ParsePrivateKeyPEM parses a PEM encoded private key. PKCS#1 ("RSA PRIVATE
+// KEY"), SEC 1 ("EC PRIVATE KEY") and PKCS#8 ("PRIVATE KEY") blocks are accepted.
+func ParsePrivateKeyPEM(data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var (
+		priv interface{}
+		err  error
+	)
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		priv, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		priv, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		priv, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse private key: %w", err)
+	}
+
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", priv)
+	}
+	return NewSigningKey(signer)
+}
+
+// LoadPrivateKeyFile reads and parses a PEM private key from path.
+func LoadPrivateKeyFile(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePrivateKeyPEM(data)
+}
+
+// LoadHMACKeyFile reads a shared secret from path. Surrounding whitespace,
+// such as a trailing newline, is not part of the secret.
+func LoadHMACKeyFile(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	secret := bytes.TrimSpace(data)
+	if len(secret) == 0 {
+		return nil, errors.New("empty secret file")
+	}
+	return NewHMACKey(secret), nil
+}
+
+// ID returns the key ID placed in the JWT "kid" header.
+func (k *SigningKey) ID() string {
+	return k.id
+}
+
+// Algorithm returns the JWT "alg" value produced by this key.
+func (k *SigningKey) Algorithm() string {
+	return k.method.Alg()
+}
+
+// PublicKey returns the verification half of the key (the secret for HMAC).
+func (k *SigningKey) PublicKey() interface{} {
+	return k.public
+}
+
+// IsSymmetric reports whether the key is a shared HMAC secret.
+func (k *SigningKey) IsSymmetric() bool {
+	_, ok := k.method.(*jwt.SigningMethodHMAC)
+	return ok
+}
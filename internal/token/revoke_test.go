@@ -0,0 +1,50 @@
+package token
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+func TestRevokeAccessTokensForUserThenLogin(t *testing.T) {
+	ctx := context.Background()
+	m := NewManager("secret", nil)
+	const userID = 7
+
+	if err := m.RevokeAccessTokensForUser(ctx, userID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+
+	// a login straight after the revocation, normally within the same second
+	raw, err := m.GenerateAccessToken(&Claims{UserID: userID, SessionID: "s1"}, "", 900)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	claims, err := m.VerifyAccessToken(raw, "")
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	revoked, err := m.IsAccessTokenRevoked(ctx, claims)
+	if err != nil {
+		t.Fatalf("is revoked: %v", err)
+	}
+	if revoked {
+		t.Errorf("token issued after the revocation is revoked")
+	}
+
+	earlier := &Claims{UserID: userID, RegisteredClaims: jwt.RegisteredClaims{
+		IssuedAt: jwt.NewNumericDate(time.Now().Add(-time.Second)),
+	}}
+	if revoked, err := m.IsAccessTokenRevoked(ctx, earlier); err != nil || !revoked {
+		t.Errorf("token issued a second before the revocation: revoked = %v, err = %v, want true", revoked, err)
+	}
+
+	other := &Claims{UserID: userID + 1, RegisteredClaims: jwt.RegisteredClaims{
+		IssuedAt: jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+	}}
+	if revoked, err := m.IsAccessTokenRevoked(ctx, other); err != nil || revoked {
+		t.Errorf("token of another user: revoked = %v, err = %v, want false", revoked, err)
+	}
+}
@@ -7,70 +7,266 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	jwt "github.com/golang-jwt/jwt/v5"
+
+	"github.com/prfc0/authN/internal/revocation"
 )
 
 // TokenManager is a small helper to generate JWT access tokens and opaque refresh tokens.
-// It does NOT perform token introspection — it only creates tokens and can verify JWT signatures.
+// It only creates tokens and verifies JWT signatures; introspection (combining that with
+// stored token state) lives in handlers.MakeIntrospectHandler.
 // Refresh tokens are persisted by callers (we provide a helper to store hashed refresh tokens).
 
 type TokenManager struct {
-	jwtSecret []byte
-	db        *sql.DB
+	keys         *KeyRing
+	db           *sql.DB
+	revocations  revocation.Store
+	issuer       string
+	audiences    []string
+	leeway       time.Duration
+	enricher     ClaimsEnricher
+	maxTokenSize int
+}
+
+// DefaultLeeway is the clock skew tolerated when checking exp, nbf and iat.
+const DefaultLeeway = 30 * time.Second
+
+// ErrInvalidAudience is returned when a token is requested for an audience
+// that is not configured.
+var ErrInvalidAudience = errors.New("invalid audience")
+
+// Option configures optional TokenManager behaviour.
+type Option func(*TokenManager)
+
+// WithRevocationStore sets where revoked access tokens are recorded. Without
+// it an in-memory store is used.
+func WithRevocationStore(s revocation.Store) Option {
+	return func(m *TokenManager) { m.revocations = s }
+}
+
+// WithIssuer sets the "iss" claim on issued tokens and requires it on verified ones.
+func WithIssuer(iss string) Option {
+	return func(m *TokenManager) { m.issuer = iss }
 }
 
-func NewManager(jwtSecret string, db *sql.DB) *TokenManager {
-	return &TokenManager{jwtSecret: []byte(jwtSecret), db: db}
+// WithAudiences sets the audiences tokens may be issued for. The first is the
+// default when a caller does not ask for a specific one.
+func WithAudiences(auds ...string) Option {
+	return func(m *TokenManager) { m.audiences = auds }
 }
 
-// GenerateAccessToken creates a signed HS256 JWT with user_id and username, exp in ttlSeconds.
-func (m *TokenManager) GenerateAccessToken(userID int64, username string, ttlSeconds int64) (string, error) {
-	if len(m.jwtSecret) == 0 {
-		return "", errors.New("jwt secret not configured")
+// WithLeeway sets the clock skew tolerated during verification.
+func WithLeeway(d time.Duration) Option {
+	return func(m *TokenManager) { m.leeway = d }
+}
+
+// NewManager returns a TokenManager signing HS256 tokens with a shared secret.
+func NewManager(jwtSecret string, db *sql.DB, opts ...Option) *TokenManager {
+	return NewManagerWithKey(NewHMACKey([]byte(jwtSecret)), db, opts...)
+}
+
+// NewManagerWithKey returns a TokenManager signing with key, which may be an
+// asymmetric key loaded via ParsePrivateKeyPEM.
+func NewManagerWithKey(key *SigningKey, db *sql.DB, opts ...Option) *TokenManager {
+	return NewManagerWithKeyRing(NewKeyRing(key, DefaultRetireAfter), db, opts...)
+}
+
+// NewManagerWithKeyRing returns a TokenManager that signs with the ring's
+// active key and verifies against any key the ring still trusts.
+func NewManagerWithKeyRing(ring *KeyRing, db *sql.DB, opts ...Option) *TokenManager {
+	m := &TokenManager{keys: ring, db: db, leeway: DefaultLeeway, maxTokenSize: DefaultMaxTokenSize}
+	for _, opt := range opts {
+		opt(m)
 	}
-	claims := jwt.MapClaims{
-		"sub":      fmt.Sprintf("%d", userID),
-		"username": username,
-		"exp":      time.Now().Add(time.Duration(ttlSeconds) * time.Second).Unix(),
-		"iat":      time.Now().Unix(),
+	if m.revocations == nil {
+		m.revocations = revocation.NewMemoryStore()
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(m.jwtSecret)
+	return m
+}
+
+// Algorithm returns the JWT "alg" used for signing.
+func (m *TokenManager) Algorithm() string {
+	return m.keys.Active().Algorithm()
 }
 
-// VerifyAccessToken verifies the token signature and returns claims map (or error).
-func (m *TokenManager) VerifyAccessToken(tokenStr string) (jwt.MapClaims, error) {
-	if len(m.jwtSecret) == 0 {
-		return nil, errors.New("jwt secret not configured")
+// Issuer returns the configured "iss" value.
+func (m *TokenManager) Issuer() string {
+	return m.issuer
+}
+
+// ResolveAudience maps a requested audience to the one a token will carry:
+// empty selects the default, anything else must be configured.
+func (m *TokenManager) ResolveAudience(aud string) (string, error) {
+	if aud == "" {
+		if len(m.audiences) == 0 {
+			return "", nil
+		}
+		return m.audiences[0], nil
 	}
-	token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+	for _, a := range m.audiences {
+		if a == aud {
+			return aud, nil
 		}
-		return m.jwtSecret, nil
-	})
+	}
+	return "", ErrInvalidAudience
+}
+
+// KeyRing returns the ring holding the manager's signing keys.
+func (m *TokenManager) KeyRing() *KeyRing {
+	return m.keys
+}
+
+// RotateSigningKey makes next the signing key without restarting; tokens signed
+// by the previous key keep verifying until it is retired.
+func (m *TokenManager) RotateSigningKey(next *SigningKey) {
+	m.keys.Rotate(next)
+}
+
+func checkKey(k *SigningKey) error {
+	if k == nil {
+		return errors.New("signing key not configured")
+	}
+	if secret, ok := k.private.([]byte); ok && len(secret) == 0 {
+		return errors.New("jwt secret not configured")
+	}
+	return nil
+}
+
+// GenerateAccessToken signs claims as a JWT valid for ttlSeconds and scoped to
+// audience (empty selects the default audience). The caller fills in the
+// user-facing fields (UserID, Username, Scopes, ...); the registered claims
+// iss, sub, aud, exp, nbf, iat and jti are set here and overwrite anything in
+// claims. Each token gets a unique "jti" so it can be revoked individually,
+// and the active key's ID is set as the "kid" header. Tokens larger than the
+// configured limit fail with ErrTokenTooLarge.
+func (m *TokenManager) GenerateAccessToken(claims *Claims, audience string, ttlSeconds int64) (string, error) {
+	key := m.keys.Active()
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	aud, err := m.ResolveAudience(audience)
+	if err != nil {
+		return "", err
+	}
+	jti, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    m.issuer,
+		Subject:   strconv.FormatInt(claims.UserID, 10),
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Duration(ttlSeconds) * time.Second)),
+		NotBefore: jwt.NewNumericDate(now),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ID:        jti,
+	}
+	if aud != "" {
+		claims.Audience = jwt.ClaimStrings{aud}
+	}
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.ID()
+	signed, err := token.SignedString(key.private)
+	if err != nil {
+		return "", err
+	}
+	if m.maxTokenSize > 0 && len(signed) > m.maxTokenSize {
+		return "", fmt.Errorf("%w: %d bytes exceeds %d", ErrTokenTooLarge, len(signed), m.maxTokenSize)
+	}
+	return signed, nil
+}
+
+// VerifyAccessToken verifies the token signature and returns its claims (or error).
+// exp and nbf are checked with the configured leeway, iss must match the
+// configured issuer, and if audience is non-empty the token must be scoped to it.
+// The verification key is selected by the "kid" header (tokens without one are
+// checked against the active key) and must match the token's "alg"; tokens
+// naming an unknown or retired key are rejected.
+func (m *TokenManager) VerifyAccessToken(tokenStr, audience string) (*Claims, error) {
+	opts := []jwt.ParserOption{jwt.WithLeeway(m.leeway), jwt.WithIssuedAt()}
+	if m.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(m.issuer))
+	}
+	if audience != "" {
+		opts = append(opts, jwt.WithAudience(audience))
+	}
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenStr, claims, m.verificationKey, opts...)
 	if err != nil {
 		return nil, err
 	}
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+	if token.Valid {
 		return claims, nil
 	}
 	return nil, errors.New("invalid token")
 }
 
+// verificationKey is the jwt.Keyfunc for tokens signed by the key ring.
+func (m *TokenManager) verificationKey(t *jwt.Token) (interface{}, error) {
+	key := m.keys.Active()
+	if kid, ok := t.Header["kid"]; ok {
+		s, ok := kid.(string)
+		if !ok {
+			return nil, errors.New("invalid kid header")
+		}
+		k, err := m.keys.Lookup(s)
+		if err != nil {
+			return nil, err
+		}
+		key = k
+	}
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	if t.Method.Alg() != key.Algorithm() {
+		return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+	}
+	return key.public, nil
+}
+
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// NewSessionID returns a random identifier for a refresh token family. It is
+// also carried in access tokens as the sid claim.
+func NewSessionID() (string, error) {
+	return newTokenID()
+}
+
 // GenerateRefreshToken creates an opaque token and returns (rawToken, hashedToken).
 // The caller should persist hashedToken (sha256 hex) and return rawToken to the user only once.
 func GenerateRefreshToken() (string, string, error) {
+	return GenerateOpaqueToken()
+}
+
+// HashRefreshToken returns the sha256 hex digest under which a raw refresh token is stored.
+func HashRefreshToken(raw string) string {
+	return HashOpaqueToken(raw)
+}
+
+// GenerateOpaqueToken creates a random token, such as a password reset token,
+// and returns it with the digest under which it is stored.
+func GenerateOpaqueToken() (string, string, error) {
 	b := make([]byte, 32)
 	if _, err := rand.Read(b); err != nil {
 		return "", "", err
 	}
 	raw := hex.EncodeToString(b)
+	return raw, HashOpaqueToken(raw), nil
+}
+
+// HashOpaqueToken returns the sha256 hex digest of raw.
+func HashOpaqueToken(raw string) string {
 	h := sha256.Sum256([]byte(raw))
-	hash := hex.EncodeToString(h[:])
-	return raw, hash, nil
+	return hex.EncodeToString(h[:])
 }
 
 // StoreRefreshToken persists hashed refresh token into refresh_tokens table.
@@ -0,0 +1,225 @@
+// Package username canonicalizes and validates usernames.
+//
+// A username has three forms: the display form users chose (trimmed and NFKC
+// normalized, case preserved), the canonical form used to look accounts up
+// (additionally case folded), and a confusable skeleton used to keep
+// look-alike names such as "alice" and "аlice" (Cyrillic а) from coexisting.
+package username
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Rule names reported in Error.Rule.
+const (
+	RuleRequired          = "required"
+	RuleMinLength         = "min_length"
+	RuleMaxLength         = "max_length"
+	RuleInvalidCharacters = "invalid_characters"
+	RuleMixedScripts      = "mixed_scripts"
+	RuleReserved          = "reserved"
+)
+
+// Error is a username rejected by Rules.Parse.
+type Error struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string { return "username " + e.Message }
+
+// Name is a username in its three forms.
+type Name struct {
+	Display   string
+	Canonical string
+	Skeleton  string
+}
+
+// Canonicalize derives the forms of raw without validating it. Use it to look
+// up existing accounts, which may predate the current rules.
+func Canonicalize(raw string) Name {
+	display := norm.NFKC.String(strings.TrimSpace(raw))
+	canonical := norm.NFKC.String(cases.Fold().String(display))
+	return Name{Display: display, Canonical: canonical, Skeleton: skeleton(canonical)}
+}
+
+// Rules decides which usernames may be registered. Lengths count characters
+// of the canonical form.
+type Rules struct {
+	MinLength int
+	MaxLength int
+	// Reserved names are refused along with anything confusable with them.
+	Reserved []string
+}
+
+// ReservedNames are names that could be mistaken for the service itself.
+var ReservedNames = []string{
+	"abuse", "account", "accounts", "admin", "administrator", "anonymous", "api", "auth",
+	"help", "hostmaster", "info", "login", "logout", "me", "moderator", "no-reply",
+	"noreply", "null", "operator", "owner", "postmaster", "register", "root", "security",
+	"self", "staff", "support", "system", "undefined", "webmaster", "www",
+}
+
+// DefaultRules allows 3 to 32 characters and refuses ReservedNames.
+var DefaultRules = Rules{MinLength: 3, MaxLength: 32, Reserved: ReservedNames}
+
+// WithReserved returns r also refusing the names in list, which is
+// comma-separated like AUTH_RESERVED_USERNAMES.
+func (r Rules) WithReserved(list string) Rules {
+	r.Reserved = append([]string(nil), r.Reserved...)
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			r.Reserved = append(r.Reserved, name)
+		}
+	}
+	return r
+}
+
+// Parse canonicalizes raw and checks it against the rules. The error, if
+// any, is an *Error.
+func (r Rules) Parse(raw string) (Name, error) {
+	n := Canonicalize(raw)
+	if n.Canonical == "" {
+		return n, &Error{RuleRequired, "is required"}
+	}
+	length := utf8.RuneCountInString(n.Canonical)
+	if length < r.MinLength {
+		return n, &Error{RuleMinLength, fmt.Sprintf("must be at least %d characters", r.MinLength)}
+	}
+	if r.MaxLength > 0 && length > r.MaxLength {
+		return n, &Error{RuleMaxLength, fmt.Sprintf("must be at most %d characters", r.MaxLength)}
+	}
+	if !validCharacters(n.Canonical) {
+		return n, &Error{RuleInvalidCharacters,
+			"may contain only letters, digits and . _ - between them"}
+	}
+	if !singleScript(n.Canonical) {
+		return n, &Error{RuleMixedScripts, "must not mix letters from different scripts"}
+	}
+	for _, name := range r.Reserved {
+		if Canonicalize(name).Skeleton == n.Skeleton {
+			return n, &Error{RuleReserved, "is reserved"}
+		}
+	}
+	return n, nil
+}
+
+// validCharacters accepts letters with their combining marks, ASCII digits
+// and single separators that neither start nor end the name.
+func validCharacters(s string) bool {
+	prev := rune(0)
+	for _, c := range s {
+		switch {
+		case unicode.IsLetter(c), c >= '0' && c <= '9':
+		case unicode.In(c, unicode.Mn, unicode.Mc):
+			if !unicode.IsLetter(prev) && !unicode.In(prev, unicode.Mn, unicode.Mc) {
+				return false
+			}
+		case c == '.' || c == '_' || c == '-':
+			if prev == 0 || isSeparator(prev) {
+				return false
+			}
+		default:
+			return false
+		}
+		prev = c
+	}
+	return !isSeparator(prev)
+}
+
+func isSeparator(c rune) bool { return c == '.' || c == '_' || c == '-' }
+
+// scriptSets are the combinations of scripts allowed in one name, following
+// the "highly restrictive" profile of Unicode TS #39.
+var scriptSets = [][]*unicode.RangeTable{
+	{unicode.Latin, unicode.Han, unicode.Hiragana, unicode.Katakana},
+	{unicode.Latin, unicode.Han, unicode.Bopomofo},
+	{unicode.Latin, unicode.Han, unicode.Hangul},
+}
+
+// singleScript reports whether the letters of s come from one script, or
+// from one of scriptSets.
+func singleScript(s string) bool {
+	var first *unicode.RangeTable
+	mixed := false
+	for _, c := range s {
+		if !hasScript(c) {
+			continue
+		}
+		if first == nil {
+			first = scriptOf(c)
+		} else if !unicode.Is(first, c) {
+			mixed = true
+			break
+		}
+	}
+	if !mixed {
+		return true
+	}
+	for _, set := range scriptSets {
+		if allIn(s, set) {
+			return true
+		}
+	}
+	return false
+}
+
+func allIn(s string, tables []*unicode.RangeTable) bool {
+	for _, c := range s {
+		if hasScript(c) && !unicode.IsOneOf(tables, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasScript reports whether c is a letter specific to one script; letters
+// shared between scripts, such as the Japanese prolonged sound mark, are not.
+func hasScript(c rune) bool {
+	return unicode.IsLetter(c) && !unicode.In(c, unicode.Common, unicode.Inherited)
+}
+
+// scriptOf returns the script table containing c, or nil.
+func scriptOf(c rune) *unicode.RangeTable {
+	for _, t := range unicode.Scripts {
+		if t != unicode.Common && t != unicode.Inherited && unicode.Is(t, c) {
+			return t
+		}
+	}
+	return nil
+}
+
+// confusables maps characters of the case-folded form to the Latin letter
+// they are commonly mistaken for. It covers the usual spoofing alphabets
+// rather than the full Unicode confusables table.
+var confusables = map[rune]rune{
+	'0': 'o', '1': 'l',
+	// Cyrillic
+	'а': 'a', 'с': 'c', 'ԁ': 'd', 'е': 'e', 'һ': 'h', 'і': 'i', 'ј': 'j', 'к': 'k',
+	'ӏ': 'l', 'о': 'o', 'р': 'p', 'ԛ': 'q', 'ѕ': 's', 'у': 'y', 'ԝ': 'w', 'х': 'x',
+	// Greek
+	'α': 'a', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'υ': 'u', 'χ': 'x',
+	// Latin
+	'ı': 'i', 'ɡ': 'g', 'ɑ': 'a',
+}
+
+// confusableSequences are letter pairs that read as a single letter.
+var confusableSequences = strings.NewReplacer("rn", "m", "vv", "w")
+
+// skeleton maps the canonical form to a representative of everything that
+// looks like it.
+func skeleton(canonical string) string {
+	s := strings.Map(func(c rune) rune {
+		if l, ok := confusables[c]; ok {
+			return l
+		}
+		return c
+	}, canonical)
+	return confusableSequences.Replace(s)
+}